@@ -3,15 +3,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
+	"tp-santak-rtu/internal/admin"
 	"tp-santak-rtu/internal/config"
 	"tp-santak-rtu/internal/handler"
 	"tp-santak-rtu/internal/pkg/logger"
 	"tp-santak-rtu/internal/platform"
+	"tp-santak-rtu/internal/profile"
 	"tp-santak-rtu/internal/tcpserver"
 
 	"github.com/sirupsen/logrus"
@@ -19,6 +26,9 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
+// defaultShutdownTimeout 未配置关闭等待时间时使用
+const defaultShutdownTimeout = 10 * time.Second
+
 func main() {
 	// 首先设置基本的日志格式
 	logrus.SetFormatter(&logrus.TextFormatter{
@@ -68,8 +78,10 @@ func run(c *cli.Context) error {
 	logrus.WithFields(logrus.Fields{
 		"port":            cfg.Server.Port,
 		"http_port":       cfg.Server.HTTPPort,
+		"admin_port":      cfg.Server.AdminPort,
 		"max_connections": cfg.Server.MaxConnections,
 		"heartbeat":       cfg.Server.HeartbeatTimeout,
+		"shutdown":        cfg.Server.ShutdownTimeout,
 		"log_level":       cfg.Log.Level,
 		"log_path":        cfg.Log.FilePath,
 		"url":             cfg.Platform.URL,
@@ -92,12 +104,17 @@ func run(c *cli.Context) error {
 		MQTTBroker:   cfg.Platform.MQTTBroker,
 		MQTTUsername: cfg.Platform.MQTTUsername,
 		MQTTPassword: cfg.Platform.MQTTPassword,
+		QueueDir:     cfg.Platform.QueueDir,
+		QueueSize:    cfg.Platform.QueueSize,
 	}, logrus.StandardLogger())
 	if err != nil {
 		return fmt.Errorf("创建平台客户端失败: %v", err)
 	}
 	defer platformClient.Close()
 	logrus.Info("平台客户端初始化成功")
+	if _, err := platformClient.RefreshServiceAccessPoints(); err != nil {
+		logrus.WithError(err).Warn("获取服务接入点失败，收到服务配置修改通知时重试")
+	}
 
 	// // 5. 创建并初始化服务管理器
 	// logrus.Info("正在初始化服务管理器...")
@@ -120,13 +137,33 @@ func run(c *cli.Context) error {
 	// defer serviceMgr.Stop()
 	// logrus.Info("服务管理器启动成功")
 
-	// 6. 创建并启动HTTP服务
-	httpHandler := handler.NewHTTPHandler(platformClient, logrus.StandardLogger())
+	// 6. 创建TCP服务，HTTP回调需要操作TCP会话
+	profiles := loadProfiles(filepath.Join(filepath.Dir(configPath), "profiles.yaml"))
+	Port := cfg.Server.Port
+	tcpServer, err := tcpserver.NewTCPServer(platformClient, tcpserver.Options{
+		Port:             fmt.Sprintf("%d", cfg.Server.Port),
+		MaxConnections:   cfg.Server.MaxConnections,
+		HeartbeatTimeout: time.Duration(cfg.Server.HeartbeatTimeout) * time.Second,
+		Poll:             cfg.Poll,
+		Report:           cfg.Report,
+		Aggregate:        cfg.Aggregate,
+		Energy:           cfg.Energy,
+		Battery:          cfg.Battery,
+		BatteryTest:      cfg.BatteryTest,
+		Profiles:         profiles,
+	}, logrus.StandardLogger())
+	if err != nil {
+		return fmt.Errorf("创建TCP服务失败: %v", err)
+	}
+
+	// 7. 创建并启动HTTP服务
+	httpHandler := handler.NewHTTPHandler(platformClient, tcpServer, time.Duration(cfg.Server.DisconnectCooldown)*time.Second, logrus.StandardLogger())
 	handlers := httpHandler.RegisterHandlers()
 	httpPort := cfg.Server.HTTPPort
+	httpServer := &http.Server{Addr: fmt.Sprintf(":%d", httpPort), Handler: handlers}
 	go func() {
 		logrus.Infof("正在启动HTTP服务，端口: %d", httpPort)
-		if err := handlers.Start(fmt.Sprintf(":%d", httpPort)); err != nil {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logrus.Errorf("HTTP服务启动失败: %v", err)
 		}
 	}()
@@ -138,16 +175,70 @@ func run(c *cli.Context) error {
 	go StartHeartbeatTask(ctx, platformClient, cfg.Platform.ServiceIdentifier)
 
 	logrus.Info("心跳任务已启动")
-	Port := cfg.Server.Port
-	tcpServer := tcpserver.NewTCPServer(platformClient, fmt.Sprintf("%d", cfg.Server.Port), logrus.StandardLogger())
+	if err := platformClient.SubscribeCommands(cfg.Platform.ServiceIdentifier, tcpServer.HandleCommand); err != nil {
+		logrus.WithError(err).Error("订阅设备命令失败")
+	}
 	go func() {
 		logrus.Infof("正在启动TCP服务，端口: %d", Port)
 		if err := tcpServer.Start(); err != nil {
 			logrus.Errorf("TCP服务启动失败: %v", err)
 		}
 	}()
-	// 7. 阻塞主goroutine,等待信号
-	select {}
+	var adminServer *admin.Server
+	if cfg.Server.AdminPort > 0 {
+		adminServer = startAdminServer(cfg.Server, tcpServer, platformClient)
+	}
+
+	// 8. 阻塞主goroutine,等待退出信号
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-sigCtx.Done()
+	stop()
+
+	// 9. 优雅关闭，整体不超过 shutdownTimeout
+	shutdownTimeout := time.Duration(cfg.Server.ShutdownTimeout) * time.Second
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	logrus.Infof("收到退出信号，开始关闭服务，最长等待 %s", shutdownTimeout)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+
+	// 先停止TCP服务，会话退出前上报设备离线，此时平台客户端仍可用
+	if err := tcpServer.Shutdown(shutdownCtx); err != nil {
+		logrus.WithError(err).Warn("等待TCP会话关闭超时")
+	}
+	cancel() // 停止心跳任务
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logrus.WithError(err).Warn("关闭HTTP服务失败")
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			logrus.WithError(err).Warn("关闭管理接口服务失败")
+		}
+	}
+	logrus.Info("=================== SANTAK-RTU 插件服务已停止 ===================")
+	return nil // 平台客户端由 defer 关闭
+}
+
+// startAdminServer 启动管理接口，未配置令牌时不启用，返回 nil
+func startAdminServer(cfg config.ServerConfig, tcpServer *tcpserver.TCPServer, platformClient *platform.PlatformClient) *admin.Server {
+	if cfg.AdminToken == "" {
+		logrus.Error("管理接口未配置 adminToken，不启用")
+		return nil
+	}
+	host := cfg.AdminHost
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	addr := net.JoinHostPort(host, fmt.Sprintf("%d", cfg.AdminPort))
+	adminServer := admin.NewServer(tcpServer, platformClient, addr, cfg.AdminToken, logrus.StandardLogger())
+	go func() {
+		if err := adminServer.Start(); err != nil {
+			logrus.Errorf("管理接口服务启动失败: %v", err)
+		}
+	}()
+	return adminServer
 }
 
 func loadConfig(configPath string) (*config.Config, error) {
@@ -172,6 +263,25 @@ func loadConfig(configPath string) (*config.Config, error) {
 	return &cfg, nil
 }
 
+// loadProfiles 加载与配置文件同目录的机型配置，文件不存在或有误时只使用内置映射
+func loadProfiles(path string) map[string]*profile.Profile {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		logrus.Infof("机型配置文件不存在，使用内置映射: %s", path)
+		return nil
+	}
+	profiles, err := profile.Load(path)
+	if err != nil {
+		logrus.WithError(err).Errorf("加载机型配置失败，使用内置映射: %s", path)
+		return nil
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	logrus.Infof("机型配置加载成功: %v", names)
+	return profiles
+}
+
 func ensureLogDir(logPath string) error {
 	dir := filepath.Dir(logPath)
 	return os.MkdirAll(dir, 0755)
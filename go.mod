@@ -3,6 +3,7 @@ module tp-santak-rtu
 go 1.23.0
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/spf13/viper v1.19.0
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 )
@@ -14,7 +15,6 @@ require (
 )
 
 require (
-	github.com/eclipse/paho.mqtt.golang v1.4.3 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
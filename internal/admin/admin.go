@@ -0,0 +1,185 @@
+// Package admin 提供运维使用的管理接口，与平台回调的 HTTP 服务使用不同端口。
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"tp-santak-rtu/internal/battery"
+	"tp-santak-rtu/internal/platform"
+	"tp-santak-rtu/internal/tcpserver"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+	"github.com/sirupsen/logrus"
+)
+
+// response 与平台回调接口一致的通用响应
+type response struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// sessionList 在线会话列表
+type sessionList struct {
+	List  []tcpserver.SessionInfo `json:"list"`
+	Total int                     `json:"total"`
+	Stats tcpserver.Stats         `json:"stats"`
+}
+
+// accessPointList 最近一次刷新的服务接入点列表
+type accessPointList struct {
+	List  []types.ServiceAccessRsp `json:"list"`
+	Total int                      `json:"total"`
+}
+
+// batteryTestList 电池自检记录
+type batteryTestList struct {
+	List  []battery.TestResult `json:"list"`
+	Total int                  `json:"total"`
+}
+
+// scheduledTestList 定时自检执行记录
+type scheduledTestList struct {
+	List  []battery.ScheduledTest `json:"list"`
+	Total int                     `json:"total"`
+}
+
+// Server 管理接口服务
+type Server struct {
+	tcp      *tcpserver.TCPServer
+	platform *platform.PlatformClient
+	token    string // 请求头 Authorization: Bearer <token>
+	logger   *logrus.Logger
+	http     *http.Server
+}
+
+// NewServer 创建管理接口服务，addr 为监听地址，token 不能为空
+func NewServer(tcp *tcpserver.TCPServer, platform *platform.PlatformClient, addr, token string, logger *logrus.Logger) *Server {
+	s := &Server{
+		tcp:      tcp,
+		platform: platform,
+		token:    token,
+		logger:   logger,
+	}
+	s.http = &http.Server{Addr: addr, Handler: s.Handler()}
+	return s
+}
+
+// Handler 返回管理接口路由，所有接口都需要携带令牌
+//
+//	GET    /api/v1/sessions              在线会话列表
+//	DELETE /api/v1/sessions/{device_id}  强制断开设备会话
+//	GET    /api/v1/access-points         服务接入点列表
+//	GET    /api/v1/queue                 遥测缓存队列统计
+//	GET    /api/v1/devices/{device_id}/battery-tests  设备电池自检记录
+//	GET    /api/v1/devices/{device_id}/scheduled-tests  设备定时自检执行记录
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/sessions", s.handleListSessions)
+	mux.HandleFunc("DELETE /api/v1/sessions/{device_id}", s.handleCloseSession)
+	mux.HandleFunc("GET /api/v1/access-points", s.handleListAccessPoints)
+	mux.HandleFunc("GET /api/v1/queue", s.handleQueueStats)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/battery-tests", s.handleBatteryTests)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/scheduled-tests", s.handleScheduledTests)
+	return s.authorize(mux)
+}
+
+// authorize 校验请求头中的令牌，令牌错误时返回 401
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			s.logger.Warnf("管理接口令牌错误: %s %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+			writeResponse(w, http.StatusUnauthorized, "unauthorized", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Start 启动管理接口服务，Shutdown 后返回 nil
+func (s *Server) Start() error {
+	s.logger.Infof("启动管理接口服务: %s", s.http.Addr)
+	if err := s.http.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown 关闭管理接口服务
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := s.tcp.Sessions()
+	writeResponse(w, http.StatusOK, "success", sessionList{
+		List:  sessions,
+		Total: len(sessions),
+		Stats: s.tcp.Stats(),
+	})
+}
+
+func (s *Server) handleCloseSession(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("device_id")
+	s.logger.WithField("device_id", deviceID).Info("管理接口请求断开设备")
+	if err := s.tcp.CloseSession(deviceID); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, tcpserver.ErrDeviceNotConnected) {
+			code = http.StatusNotFound
+		}
+		writeResponse(w, code, err.Error(), nil)
+		return
+	}
+	writeResponse(w, http.StatusOK, "success", nil)
+}
+
+func (s *Server) handleListAccessPoints(w http.ResponseWriter, r *http.Request) {
+	points := s.platform.ServiceAccessPoints()
+	writeResponse(w, http.StatusOK, "success", accessPointList{
+		List:  points,
+		Total: len(points),
+	})
+}
+
+func (s *Server) handleQueueStats(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, "success", s.platform.QueueStats())
+}
+
+func (s *Server) handleBatteryTests(w http.ResponseWriter, r *http.Request) {
+	results, err := s.tcp.BatteryTests(r.PathValue("device_id"))
+	if err != nil {
+		writeResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	writeResponse(w, http.StatusOK, "success", batteryTestList{
+		List:  results,
+		Total: len(results),
+	})
+}
+
+func (s *Server) handleScheduledTests(w http.ResponseWriter, r *http.Request) {
+	results, err := s.tcp.ScheduledTests(r.PathValue("device_id"))
+	if err != nil {
+		writeResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	writeResponse(w, http.StatusOK, "success", scheduledTestList{
+		List:  results,
+		Total: len(results),
+	})
+}
+
+func writeResponse(w http.ResponseWriter, code int, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response{
+		Code:    code,
+		Message: message,
+		Data:    data,
+	})
+}
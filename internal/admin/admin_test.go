@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tp-santak-rtu/internal/platform"
+	"tp-santak-rtu/internal/tcpserver"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAuthorize(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p, err := platform.New(platform.Config{BaseURL: "http://127.0.0.1:1"}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	tcp, err := tcpserver.NewTCPServer(p, tcpserver.Options{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(tcp, p, "", "secret", logger).Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		want   int
+	}{
+		{"未携带令牌", http.MethodGet, "/api/v1/sessions", "", http.StatusUnauthorized},
+		{"令牌错误", http.MethodGet, "/api/v1/sessions", "Bearer secret2", http.StatusUnauthorized},
+		{"缺少 Bearer", http.MethodGet, "/api/v1/sessions", "secret", http.StatusUnauthorized},
+		{"未携带令牌断开会话", http.MethodDelete, "/api/v1/sessions/dev-1", "", http.StatusUnauthorized},
+		{"会话列表", http.MethodGet, "/api/v1/sessions", "Bearer secret", http.StatusOK},
+		{"设备未连接", http.MethodDelete, "/api/v1/sessions/dev-1", "Bearer secret", http.StatusNotFound},
+		{"未携带令牌查询接入点", http.MethodGet, "/api/v1/access-points", "", http.StatusUnauthorized},
+		{"服务接入点", http.MethodGet, "/api/v1/access-points", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("状态码 = %d, 期望 %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAuthorizeEmptyToken(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	tcp, err := tcpserver.NewTCPServer(nil, tcpserver.Options{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(tcp, nil, "", "", logger).Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("未配置令牌时状态码 = %d, 期望 401", rec.Code)
+	}
+}
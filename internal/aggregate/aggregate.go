@@ -0,0 +1,134 @@
+// Package aggregate 按设备在时间窗口内累计数值遥测，窗口结束时输出最小、最大、平均值和最后一个值。
+package aggregate
+
+import (
+	"math"
+	"sync"
+	"time"
+	"tp-santak-rtu/internal/reading"
+)
+
+// 统计值键名后缀
+const (
+	SuffixMin = "_min"
+	SuffixMax = "_max"
+	SuffixAvg = "_avg"
+)
+
+// series 一个键在窗口内的统计
+type series struct {
+	min, max, sum, last float64
+	n                   int
+}
+
+// window 单个设备当前的聚合窗口
+type window struct {
+	start  time.Time
+	series map[string]*series
+}
+
+// Aggregator 按设备聚合数值遥测，并发安全
+type Aggregator struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	devices map[string]*window
+}
+
+// New 创建聚合器，d 不大于0时不聚合，Add 原样返回数据
+func New(d time.Duration) *Aggregator {
+	return &Aggregator{window: d, devices: make(map[string]*window)}
+}
+
+// Add 累计本次上报的数值。返回需要立即上报的状态位和非数值键，
+// 以及窗口结束时的统计值，窗口未结束时 aggregated 为 nil。
+func (a *Aggregator) Add(deviceID string, data map[string]interface{}, now time.Time) (passthrough, aggregated map[string]interface{}) {
+	if a.window <= 0 {
+		return data, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	w, ok := a.devices[deviceID]
+	if !ok {
+		w = &window{start: now, series: make(map[string]*series)}
+		a.devices[deviceID] = w
+	}
+	passthrough = make(map[string]interface{})
+	for k, v := range data {
+		f, ok := aggregable(k, v)
+		if !ok {
+			passthrough[k] = v
+			continue
+		}
+		w.add(k, f)
+	}
+	if now.Sub(w.start) >= a.window {
+		aggregated = w.result()
+		delete(a.devices, deviceID)
+	}
+	return passthrough, aggregated
+}
+
+// Passthrough 返回 data 中不参与聚合、需要立即上报的键值，不聚合时原样返回
+func (a *Aggregator) Passthrough(data map[string]interface{}) map[string]interface{} {
+	if a.window <= 0 {
+		return data
+	}
+	passthrough := make(map[string]interface{})
+	for k, v := range data {
+		if _, ok := aggregable(k, v); !ok {
+			passthrough[k] = v
+		}
+	}
+	return passthrough
+}
+
+// aggregable 状态位以外的数值键参与聚合，返回其数值
+func aggregable(key string, v interface{}) (float64, bool) {
+	f, ok := reading.Number(v)
+	if !ok || reading.IsStatus(key) {
+		return 0, false
+	}
+	return f, true
+}
+
+// Flush 结束设备当前的窗口并返回统计值，没有累计数据时返回 nil。会话结束时调用。
+func (a *Aggregator) Flush(deviceID string) map[string]interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	w, ok := a.devices[deviceID]
+	if !ok {
+		return nil
+	}
+	delete(a.devices, deviceID)
+	return w.result()
+}
+
+func (w *window) add(key string, v float64) {
+	s, ok := w.series[key]
+	if !ok {
+		w.series[key] = &series{min: v, max: v, sum: v, last: v, n: 1}
+		return
+	}
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+	s.sum += v
+	s.last = v
+	s.n++
+}
+
+// result 输出窗口统计，键名为 <key>、<key>_min、<key>_max、<key>_avg
+func (w *window) result() map[string]interface{} {
+	if len(w.series) == 0 {
+		return nil
+	}
+	data := make(map[string]interface{}, len(w.series)*4)
+	for k, s := range w.series {
+		data[k] = s.last
+		data[k+SuffixMin] = s.min
+		data[k+SuffixMax] = s.max
+		// 去掉求平均带来的浮点误差
+		data[k+SuffixAvg] = math.Round(s.sum/float64(s.n)*1000) / 1000
+	}
+	return data
+}
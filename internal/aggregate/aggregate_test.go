@@ -0,0 +1,62 @@
+package aggregate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddWindow(t *testing.T) {
+	a := New(time.Minute)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+
+	pass, agg := a.Add("dev", map[string]interface{}{
+		"loadpercentage":    40.0,
+		"utilityfailstatus": 0,
+		"upsstate":          "online",
+	}, start)
+	if agg != nil {
+		t.Fatalf("窗口未结束不应输出统计值: %v", agg)
+	}
+	want := map[string]interface{}{"utilityfailstatus": 0, "upsstate": "online"}
+	if !reflect.DeepEqual(pass, want) {
+		t.Errorf("passthrough = %v, 期望 %v", pass, want)
+	}
+
+	a.Add("dev", map[string]interface{}{"loadpercentage": 50.0}, start.Add(30*time.Second))
+	_, agg = a.Add("dev", map[string]interface{}{"loadpercentage": 45.0}, start.Add(time.Minute))
+	want = map[string]interface{}{
+		"loadpercentage":     45.0,
+		"loadpercentage_min": 40.0,
+		"loadpercentage_max": 50.0,
+		"loadpercentage_avg": 45.0,
+	}
+	if !reflect.DeepEqual(agg, want) {
+		t.Errorf("aggregated = %v, 期望 %v", agg, want)
+	}
+	if rest := a.Flush("dev"); rest != nil {
+		t.Errorf("窗口输出后 Flush = %v, 期望 nil", rest)
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	readings := map[string]interface{}{
+		"loadpercentage":    40.0,
+		"batteryvoltage":    81.6,
+		"utilityfailstatus": 1,
+		"upsstate":          "on-battery",
+		"faultcode":         "00",
+	}
+	got := New(time.Minute).Passthrough(readings)
+	want := map[string]interface{}{
+		"utilityfailstatus": 1,
+		"upsstate":          "on-battery",
+		"faultcode":         "00",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Passthrough = %v, 期望 %v", got, want)
+	}
+	if got := New(0).Passthrough(readings); !reflect.DeepEqual(got, readings) {
+		t.Errorf("不聚合时 Passthrough = %v, 期望原样返回", got)
+	}
+}
@@ -0,0 +1,86 @@
+// Package alarm 根据 UPS 状态位的变化生成告警事件。
+package alarm
+
+import (
+	"sync"
+	"time"
+	"tp-santak-rtu/internal/reading"
+)
+
+// Event 状态位变化产生的事件，Method 为平台事件标识
+type Event struct {
+	Method  string
+	Message string
+	Key     string // 触发事件的状态键
+	Active  bool   // true 为告警产生，false 为告警恢复
+	Time    time.Time
+}
+
+// Params 平台事件参数，readings 为状态变化时设备的最新读数
+func (e Event) Params(readings map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"key":      e.Key,
+		"active":   reading.BoolToInt(e.Active),
+		"message":  e.Message,
+		"ts":       e.Time.UnixMilli(),
+		"readings": readings,
+	}
+}
+
+// rule 一个状态位对应的告警产生/恢复事件
+type rule struct {
+	key          string
+	raise, clear string // 事件标识
+	raiseMsg     string
+	clearMsg     string
+}
+
+// rules 检测的状态位，按事件重要程度排列
+var rules = []rule{
+	{"utilityfailstatus", "mains_lost", "mains_restored", "市电中断，电池供电", "市电恢复"},
+	{"batterylowstatus", "battery_low", "battery_low_cleared", "电池电压低", "电池电压恢复"},
+	{"upsfailedstatus", "ups_fault", "ups_fault_cleared", "UPS故障", "UPS故障恢复"},
+	{"bypassstatus", "bypass_entered", "bypass_exited", "UPS进入旁路", "UPS退出旁路"},
+	{"shutdownstatus", "shutdown_active", "shutdown_cancelled", "关机倒计时中", "关机取消"},
+}
+
+// Detector 按设备记录状态位，检测变化。设备状态跨会话保留，DTU 重连不会重复产生事件。
+type Detector struct {
+	mu     sync.Mutex
+	states map[string]map[string]bool // 设备ID -> 状态键 -> 是否告警
+}
+
+// NewDetector 创建告警检测器
+func NewDetector() *Detector {
+	return &Detector{states: make(map[string]map[string]bool)}
+}
+
+// Detect 比较 data 中的状态位与上次的值，返回变化产生的事件。
+// 设备首次上报时只对处于告警状态的状态位产生事件，不产生恢复事件。
+func (d *Detector) Detect(deviceID string, data map[string]interface{}, now time.Time) []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state, ok := d.states[deviceID]
+	if !ok {
+		state = make(map[string]bool)
+		d.states[deviceID] = state
+	}
+	var events []Event
+	for _, r := range rules {
+		active, ok := reading.Flag(data, r.key)
+		if !ok {
+			continue
+		}
+		last, seen := state[r.key]
+		state[r.key] = active
+		if (seen && last == active) || (!seen && !active) {
+			continue
+		}
+		ev := Event{Key: r.key, Active: active, Time: now, Method: r.raise, Message: r.raiseMsg}
+		if !active {
+			ev.Method, ev.Message = r.clear, r.clearMsg
+		}
+		events = append(events, ev)
+	}
+	return events
+}
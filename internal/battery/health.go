@@ -0,0 +1,201 @@
+package battery
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"tp-santak-rtu/internal/reading"
+)
+
+// KeyHealth 发布的电池健康度遥测键，0~100
+const KeyHealth = "batteryhealth"
+
+// EventTestCompleted 电池自检结束事件
+const EventTestCompleted = "battery_test_completed"
+
+const (
+	historyDir = "tests" // 自检记录目录，每台设备一个 JSON Lines 文件
+
+	// 健康度按自检期间电压跌落百分比计算：跌落不超过 healthyDrop 为100，每多跌落1%扣 dropPenalty
+	healthyDrop = 2.0
+	dropPenalty = 8.0
+)
+
+// TestResult 一次电池自检的记录
+type TestResult struct {
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Duration      float64   `json:"duration_s"`     // 秒
+	VoltageBefore float64   `json:"voltage_before"` // 自检开始前最后一次电池电压
+	VoltageMin    float64   `json:"voltage_min"`    // 自检期间最低电池电压
+	VoltageEnd    float64   `json:"voltage_end"`    // 自检期间最后一次电池电压
+	VoltageDrop   float64   `json:"voltage_drop"`   // VoltageBefore - VoltageMin
+	DropPercent   float64   `json:"drop_percent"`
+	Health        float64   `json:"health"` // 健康度，Valid 为 false 时无意义
+	Valid         bool      `json:"valid"`  // 自检前后都采到了电池电压
+}
+
+// Params 自检结束事件参数
+func (r TestResult) Params() map[string]interface{} {
+	params := map[string]interface{}{
+		"start":      r.Start.UnixMilli(),
+		"end":        r.End.UnixMilli(),
+		"duration_s": r.Duration,
+		"valid":      reading.BoolToInt(r.Valid),
+	}
+	if r.Valid {
+		params["voltage_before"] = r.VoltageBefore
+		params["voltage_min"] = r.VoltageMin
+		params["voltage_end"] = r.VoltageEnd
+		params["voltage_drop"] = r.VoltageDrop
+		params["drop_percent"] = r.DropPercent
+		params["health"] = r.Health
+	}
+	return params
+}
+
+// testState 设备的自检跟踪状态
+type testState struct {
+	lastVoltage float64 // 自检开始前最后一次电池电压，0 表示未采到
+	active      *TestResult
+	sampled     bool // 自检期间是否采到电池电压
+}
+
+// HealthTracker 根据 testinprogressstatus 检测电池自检，记录自检期间的电压变化并计算健康度，并发安全
+type HealthTracker struct {
+	dir string // 电池数据目录，为空时不保存记录
+
+	mu      sync.Mutex
+	devices map[string]*testState
+}
+
+// NewHealthTracker 创建健康度跟踪器，自检记录保存在 dir 下，dir 为空时不保存
+func NewHealthTracker(dir string) *HealthTracker {
+	return &HealthTracker{dir: dir, devices: make(map[string]*testState)}
+}
+
+// Update 处理一次上报的数据，自检结束时返回自检记录。err 为保存记录的错误。
+func (t *HealthTracker) Update(deviceID string, data map[string]interface{}, now time.Time) (*TestResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.devices[deviceID]
+	if !ok {
+		st = &testState{}
+		t.devices[deviceID] = st
+	}
+
+	var done *TestResult
+	if v, ok := reading.Number(data["testinprogressstatus"]); ok {
+		switch {
+		case v != 0 && st.active == nil:
+			st.active = &TestResult{Start: now, VoltageBefore: st.lastVoltage}
+			st.sampled = false
+		case v == 0 && st.active != nil:
+			done = st.finish(now)
+		}
+	}
+	if v, ok := reading.Number(data["batteryvoltage"]); ok && v > 0 {
+		if st.active != nil {
+			if !st.sampled || v < st.active.VoltageMin {
+				st.active.VoltageMin = v
+			}
+			st.active.VoltageEnd = v
+			st.sampled = true
+		} else {
+			st.lastVoltage = v
+		}
+	}
+	if done == nil {
+		return nil, nil
+	}
+	return done, t.append(deviceID, *done)
+}
+
+// finish 结束自检并计算电压跌落和健康度
+func (st *testState) finish(now time.Time) *TestResult {
+	r := st.active
+	st.active = nil
+	r.End = now
+	r.Duration = math.Round(now.Sub(r.Start).Seconds())
+	r.Valid = st.sampled && r.VoltageBefore > 0
+	if r.Valid {
+		r.VoltageDrop = round2(math.Max(0, r.VoltageBefore-r.VoltageMin))
+		r.DropPercent = round2(r.VoltageDrop / r.VoltageBefore * 100)
+		r.Health = math.Round(math.Max(0, math.Min(100, 100-math.Max(0, r.DropPercent-healthyDrop)*dropPenalty)))
+	}
+	return r
+}
+
+// append 追加设备的自检记录
+func (t *HealthTracker) append(deviceID string, r TestResult) error {
+	if t.dir == "" {
+		return nil
+	}
+	return appendRecord(t.historyPath(deviceID), r)
+}
+
+// History 返回设备的全部自检记录，按时间先后排列
+func (t *HealthTracker) History(deviceID string) ([]TestResult, error) {
+	if t.dir == "" {
+		return nil, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return readRecords[TestResult](t.historyPath(deviceID))
+}
+
+// appendRecord 向 JSON Lines 文件追加一条记录
+func appendRecord(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建记录目录失败: %v", err)
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("序列化记录失败: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开记录文件失败: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入记录失败: %v", err)
+	}
+	return nil
+}
+
+// readRecords 读取 JSON Lines 文件中的全部记录，无法解析的行被跳过，文件不存在时返回空
+func readRecords[T any](path string) ([]T, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开记录文件失败: %v", err)
+	}
+	defer f.Close()
+	var records []T
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r T
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// historyPath 设备自检记录文件，设备ID作为文件名
+func (t *HealthTracker) historyPath(deviceID string) string {
+	return filepath.Join(t.dir, historyDir, filepath.Base(deviceID)+".jsonl")
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,245 @@
+// Package battery 估算电池后备时间，并根据实际放电过程校准。
+package battery
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"tp-santak-rtu/internal/reading"
+)
+
+// 发布的遥测键
+const (
+	KeyRemaining  = "runtimeremaining"  // 电池供电时的剩余后备时间，分钟
+	KeyProjected  = "runtimeprojected"  // 市电供电时按当前负载和电量预计的后备时间，分钟
+	KeyConfidence = "runtimeconfidence" // 估算置信度，0~100
+)
+
+const (
+	calibrationFile = "calibration.json"
+
+	defaultRuntimeFull = 10.0 // 未配置时假定的满载满电后备时间，分钟
+	defaultExponent    = 1.2  // 未配置半载后备时间时，后备时间与负载的幂指数
+	minLoad            = 5.0  // 负载低于该百分比时按该值估算，避免结果发散
+
+	minCalibrationDrop     = 5.0             // 参与校准的放电过程最少消耗的电量，%
+	minCalibrationDuration = 2 * time.Minute // 参与校准的放电过程最短时间
+	calibrationWeight      = 0.3             // 新的放电过程在校准系数中的权重
+	minFactor, maxFactor   = 0.2, 3.0        // 校准系数的范围，排除异常放电过程
+)
+
+// Params 机型电池参数，来自设备配置表单，未配置的项为0
+type Params struct {
+	RuntimeFull  float64 // 满载满电后备时间，分钟
+	RuntimeHalf  float64 // 半载满电后备时间，分钟
+	VoltageFull  float64 // 满电电池电压，UPS 不上报电量时按电压估算
+	VoltageEmpty float64 // 放电截止电池电压
+}
+
+// Estimate 一次后备时间估算
+type Estimate struct {
+	Minutes    float64
+	Confidence float64
+	OnBattery  bool
+}
+
+// Telemetry 返回估算结果的遥测键值
+func (e Estimate) Telemetry() map[string]interface{} {
+	key := KeyProjected
+	if e.OnBattery {
+		key = KeyRemaining
+	}
+	return map[string]interface{}{
+		key:           math.Round(e.Minutes*10) / 10,
+		KeyConfidence: math.Round(e.Confidence),
+	}
+}
+
+// calibration 设备的校准数据
+type calibration struct {
+	Factor  float64 `json:"factor"`  // 实测后备时间与模型估算之比
+	Samples int     `json:"samples"` // 参与校准的放电过程数
+
+	discharge *discharge // 进行中的放电过程，不保存
+}
+
+// discharge 一次放电过程的起点和负载累计
+type discharge struct {
+	start    time.Time
+	startSOC float64
+	lastSOC  float64
+	last     time.Time
+	loadSum  float64
+	loadN    int
+}
+
+// Estimator 按设备估算后备时间，并发安全
+type Estimator struct {
+	path string // 校准数据文件，为空时不保存
+
+	mu      sync.Mutex
+	devices map[string]*calibration
+}
+
+// NewEstimator 创建估算器，加载 dir 下的校准数据，dir 为空时不保存校准数据
+func NewEstimator(dir string) (*Estimator, error) {
+	e := &Estimator{devices: make(map[string]*calibration)}
+	if dir == "" {
+		return e, nil
+	}
+	e.path = filepath.Join(dir, calibrationFile)
+	data, err := os.ReadFile(e.path)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取电池校准数据失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &e.devices); err != nil {
+		return nil, fmt.Errorf("解析电池校准数据失败: %v", err)
+	}
+	return e, nil
+}
+
+// Update 按设备最新读数估算后备时间，电池供电期间记录放电过程，放电结束时校准。
+// 缺少电量(或电压)和负载读数时 ok 为 false。err 为保存校准数据的错误。
+func (e *Estimator) Update(deviceID string, p Params, readings map[string]interface{}, now time.Time) (est Estimate, ok bool, err error) {
+	soc, fromVoltage, ok := stateOfCharge(p, readings)
+	if !ok {
+		return Estimate{}, false, nil
+	}
+	load, ok := reading.Number(readings["loadpercentage"])
+	if !ok {
+		return Estimate{}, false, nil
+	}
+	utilityFail, _ := reading.Flag(readings, "utilityfailstatus")
+	selfTest, _ := reading.Flag(readings, "testinprogressstatus")
+	est.OnBattery = utilityFail || selfTest
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, found := e.devices[deviceID]
+	if !found {
+		c = &calibration{Factor: 1}
+		e.devices[deviceID] = c
+	}
+	if est.OnBattery {
+		c.track(soc, load, now)
+	} else if c.discharge != nil {
+		if c.finish(p) {
+			err = e.saveLocked()
+		}
+	}
+
+	est.Minutes = fullRuntime(p, load) * c.Factor * soc / 100
+	est.Confidence = confidence(p, c.Samples, fromVoltage, load)
+	return est, true, err
+}
+
+// track 记录放电过程中的电量和负载
+func (c *calibration) track(soc, load float64, now time.Time) {
+	if c.discharge == nil {
+		c.discharge = &discharge{start: now, startSOC: soc}
+	}
+	d := c.discharge
+	d.last = now
+	d.lastSOC = soc
+	d.loadSum += load
+	d.loadN++
+}
+
+// finish 放电结束，放电过程足够长时按实测更新校准系数，返回是否已更新
+func (c *calibration) finish(p Params) bool {
+	d := c.discharge
+	c.discharge = nil
+	drop := d.startSOC - d.lastSOC
+	duration := d.last.Sub(d.start)
+	if drop < minCalibrationDrop || duration < minCalibrationDuration || d.loadN == 0 {
+		return false
+	}
+	// 实测的满电后备时间与模型估算之比
+	observed := duration.Minutes() * 100 / drop
+	ratio := observed / fullRuntime(p, d.loadSum/float64(d.loadN))
+	if ratio < minFactor || ratio > maxFactor {
+		return false
+	}
+	if c.Samples == 0 {
+		c.Factor = ratio
+	} else {
+		c.Factor = c.Factor*(1-calibrationWeight) + ratio*calibrationWeight
+	}
+	c.Samples++
+	return true
+}
+
+// saveLocked 保存校准数据，调用方持有锁
+func (e *Estimator) saveLocked() error {
+	if e.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(e.devices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化电池校准数据失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(e.path), 0755); err != nil {
+		return fmt.Errorf("创建电池数据目录失败: %v", err)
+	}
+	tmp := e.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入电池校准数据失败: %v", err)
+	}
+	return os.Rename(tmp, e.path)
+}
+
+// fullRuntime 按负载百分比估算满电后备时间(分钟)：runtime = 满载后备时间 × (100/负载)^k，
+// 配置了半载后备时间时 k 由满载、半载两点确定
+func fullRuntime(p Params, load float64) float64 {
+	full := p.RuntimeFull
+	if full <= 0 {
+		full = defaultRuntimeFull
+	}
+	k := defaultExponent
+	if p.RuntimeFull > 0 && p.RuntimeHalf > p.RuntimeFull {
+		k = math.Log(p.RuntimeHalf/p.RuntimeFull) / math.Log(2)
+	}
+	if load < minLoad {
+		load = minLoad
+	}
+	return full * math.Pow(100/load, k)
+}
+
+// confidence 估算置信度：机型参数、校准次数越多越高，按电压估算电量或负载过低时降低
+func confidence(p Params, samples int, fromVoltage bool, load float64) float64 {
+	c := 30.0
+	if p.RuntimeFull > 0 {
+		c = 50
+	}
+	c += math.Min(float64(samples)*10, 40)
+	if fromVoltage {
+		c -= 20
+	}
+	if load < minLoad {
+		c -= 10
+	}
+	return math.Max(5, math.Min(95, c))
+}
+
+// stateOfCharge 返回电池电量百分比，UPS 未上报电量时按电池电压在截止电压和满电电压之间线性估算
+func stateOfCharge(p Params, readings map[string]interface{}) (soc float64, fromVoltage bool, ok bool) {
+	if v, ok := reading.Number(readings["batterylevel"]); ok {
+		return clamp(v), false, true
+	}
+	v, ok := reading.Number(readings["batteryvoltage"])
+	if !ok || p.VoltageFull <= p.VoltageEmpty || p.VoltageEmpty <= 0 {
+		return 0, false, false
+	}
+	return clamp((v - p.VoltageEmpty) / (p.VoltageFull - p.VoltageEmpty) * 100), true, true
+}
+
+func clamp(soc float64) float64 {
+	return math.Max(0, math.Min(100, soc))
+}
@@ -0,0 +1,202 @@
+package battery
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 满载 10 分钟、半载 25 分钟的机型，半载满电后备时间为 25 分钟
+var params = Params{RuntimeFull: 10, RuntimeHalf: 25}
+
+func readings(level, load float64, onBattery bool) map[string]interface{} {
+	r := map[string]interface{}{
+		"batterylevel":      level,
+		"loadpercentage":    load,
+		"utilityfailstatus": 0,
+	}
+	if onBattery {
+		r["utilityfailstatus"] = 1
+	}
+	return r
+}
+
+func update(t *testing.T, e *Estimator, p Params, r map[string]interface{}, now time.Time) Estimate {
+	t.Helper()
+	est, ok, err := e.Update("dev", p, r, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("Update(%v) 未能估算", r)
+	}
+	return est
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+func TestFullRuntime(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Params
+		load float64
+		want float64
+	}{
+		{"满载", params, 100, 10},
+		{"半载", params, 50, 25},
+		{"未配置机型参数", Params{}, 100, defaultRuntimeFull},
+		{"未配置半载使用默认幂指数", Params{RuntimeFull: 10}, 50, 10 * math.Pow(2, defaultExponent)},
+		{"负载过低按最小负载", params, 0, fullRuntime(params, minLoad)},
+	}
+	for _, tt := range tests {
+		if got := fullRuntime(tt.p, tt.load); !near(got, tt.want) {
+			t.Errorf("%s: fullRuntime = %v, 期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateEstimate(t *testing.T) {
+	e, err := NewEstimator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+
+	est := update(t, e, params, readings(80, 50, false), now)
+	if est.OnBattery || !near(est.Minutes, 20) || est.Confidence != 50 {
+		t.Errorf("市电供电 = %+v, 期望 20 分钟 置信度 50", est)
+	}
+	tel := est.Telemetry()
+	if _, ok := tel[KeyProjected]; !ok {
+		t.Errorf("市电供电时应上报 %s: %v", KeyProjected, tel)
+	}
+
+	est = update(t, e, params, readings(80, 50, true), now)
+	if !est.OnBattery {
+		t.Error("市电中断时应为电池供电")
+	}
+	if _, ok := est.Telemetry()[KeyRemaining]; !ok {
+		t.Errorf("电池供电时应上报 %s", KeyRemaining)
+	}
+
+	if _, ok, _ := e.Update("dev", params, map[string]interface{}{"loadpercentage": 50.0}, now); ok {
+		t.Error("缺少电量和电压时不应估算")
+	}
+	if _, ok, _ := e.Update("dev", params, map[string]interface{}{"batterylevel": 80.0}, now); ok {
+		t.Error("缺少负载时不应估算")
+	}
+}
+
+func TestStateOfChargeFromVoltage(t *testing.T) {
+	p := Params{VoltageFull: 27, VoltageEmpty: 21}
+	tests := []struct {
+		voltage float64
+		want    float64
+	}{
+		{24, 50},
+		{27.6, 100},
+		{20, 0},
+	}
+	for _, tt := range tests {
+		soc, fromVoltage, ok := stateOfCharge(p, map[string]interface{}{"batteryvoltage": tt.voltage})
+		if !ok || !fromVoltage || !near(soc, tt.want) {
+			t.Errorf("电压 %v: soc = %v %v %v, 期望 %v", tt.voltage, soc, fromVoltage, ok, tt.want)
+		}
+	}
+	if _, _, ok := stateOfCharge(Params{}, map[string]interface{}{"batteryvoltage": 24.0}); ok {
+		t.Error("未配置电压范围时不应按电压估算")
+	}
+	// 上报电量时优先使用电量
+	if soc, fromVoltage, _ := stateOfCharge(p, map[string]interface{}{"batterylevel": 90.0, "batteryvoltage": 24.0}); soc != 90 || fromVoltage {
+		t.Errorf("电量优先: soc = %v fromVoltage = %v", soc, fromVoltage)
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	tests := []struct {
+		name        string
+		p           Params
+		samples     int
+		fromVoltage bool
+		load        float64
+		want        float64
+	}{
+		{"未配置机型参数", Params{}, 0, false, 50, 30},
+		{"配置机型参数", params, 0, false, 50, 50},
+		{"校准两次", params, 2, false, 50, 70},
+		{"校准次数上限", params, 10, false, 50, 90},
+		{"按电压估算电量", params, 0, true, 50, 30},
+		{"负载过低", params, 0, false, 1, 40},
+		{"下限", Params{}, 0, true, 1, 5},
+	}
+	for _, tt := range tests {
+		if got := confidence(tt.p, tt.samples, tt.fromVoltage, tt.load); got != tt.want {
+			t.Errorf("%s: confidence = %v, 期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCalibration(t *testing.T) {
+	dir := t.TempDir()
+	e, err := NewEstimator(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+
+	// 半载放电 10 分钟消耗 20% 电量：实测满电后备时间 50 分钟，是模型的 2 倍
+	update(t, e, params, readings(100, 50, true), start)
+	update(t, e, params, readings(90, 50, true), start.Add(5*time.Minute))
+	update(t, e, params, readings(80, 50, true), start.Add(10*time.Minute))
+	est := update(t, e, params, readings(80, 50, false), start.Add(11*time.Minute))
+	if !near(est.Minutes, 40) || est.Confidence != 60 {
+		t.Errorf("校准后 = %+v, 期望 40 分钟 置信度 60", est)
+	}
+
+	// 校准数据在重启后保留
+	e, err = NewEstimator(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est := update(t, e, params, readings(80, 50, false), start.Add(time.Hour)); !near(est.Minutes, 40) {
+		t.Errorf("重新加载后 = %v 分钟, 期望 40", est.Minutes)
+	}
+}
+
+func TestCalibrationIgnored(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		name  string
+		end   time.Duration
+		level float64
+	}{
+		{"放电时间过短", time.Minute, 80},
+		{"消耗电量过少", 10 * time.Minute, 98},
+		{"实测偏差过大", 3 * time.Minute, 0}, // 实测满电后备时间 3 分钟，低于模型的 0.2 倍
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := NewEstimator("")
+			update(t, e, params, readings(100, 50, true), start)
+			update(t, e, params, readings(tt.level, 50, true), start.Add(tt.end))
+			est := update(t, e, params, readings(100, 50, false), start.Add(tt.end+time.Minute))
+			if !near(est.Minutes, 25) || est.Confidence != 50 {
+				t.Errorf("不应校准: %+v", est)
+			}
+		})
+	}
+}
+
+func TestNewEstimatorCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, calibrationFile), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEstimator(dir); err == nil {
+		t.Error("校准数据损坏时应返回错误")
+	}
+}
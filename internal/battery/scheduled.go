@@ -0,0 +1,65 @@
+package battery
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// EventTestScheduled 定时自检执行结果事件
+const EventTestScheduled = "battery_test_scheduled"
+
+// scheduledDir 定时自检执行结果目录，每台设备一个 JSON Lines 文件
+const scheduledDir = "scheduled"
+
+// 定时自检的执行结果
+const (
+	OutcomeStarted = "started" // 自检指令已被 UPS 接受
+	OutcomeSkipped = "skipped" // 不满足自检条件，未发送指令
+	OutcomeFailed  = "failed"  // 指令发送失败或被 UPS 拒绝
+)
+
+// ScheduledTest 一次定时自检的执行记录，自检本身的电压记录见 TestResult
+type ScheduledTest struct {
+	Time     time.Time `json:"time"`
+	Schedule string    `json:"schedule"` // 自检计划名称
+	Method   string    `json:"method"`
+	Command  string    `json:"command"`
+	Outcome  string    `json:"outcome"`
+	Reason   string    `json:"reason,omitempty"` // 跳过或失败的原因
+}
+
+// Params 定时自检事件参数
+func (r ScheduledTest) Params() map[string]interface{} {
+	return map[string]interface{}{
+		"ts":       r.Time.UnixMilli(),
+		"schedule": r.Schedule,
+		"method":   r.Method,
+		"command":  r.Command,
+		"outcome":  r.Outcome,
+		"reason":   r.Reason,
+	}
+}
+
+// RecordScheduled 追加设备的定时自检执行记录
+func (t *HealthTracker) RecordScheduled(deviceID string, r ScheduledTest) error {
+	if t.dir == "" {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return appendRecord(t.scheduledPath(deviceID), r)
+}
+
+// ScheduledHistory 返回设备的全部定时自检执行记录，按时间先后排列
+func (t *HealthTracker) ScheduledHistory(deviceID string) ([]ScheduledTest, error) {
+	if t.dir == "" {
+		return nil, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return readRecords[ScheduledTest](t.scheduledPath(deviceID))
+}
+
+func (t *HealthTracker) scheduledPath(deviceID string) string {
+	return filepath.Join(t.dir, scheduledDir, filepath.Base(deviceID)+".jsonl")
+}
@@ -1,17 +1,30 @@
 // internal/config/config.go
 package config
 
+import "time"
+
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Platform PlatformConfig `yaml:"platform"`
-	Log      LogConfig      `yaml:"log"`
+	Server      ServerConfig      `yaml:"server"`
+	Platform    PlatformConfig    `yaml:"platform"`
+	Log         LogConfig         `yaml:"log"`
+	Poll        PollConfig        `yaml:"poll"`
+	Report      ReportConfig      `yaml:"report"`
+	Aggregate   AggregateConfig   `yaml:"aggregate"`
+	Energy      EnergyConfig      `yaml:"energy"`
+	Battery     BatteryConfig     `yaml:"battery"`
+	BatteryTest BatteryTestConfig `yaml:"batteryTest"`
 }
 
 type ServerConfig struct {
-	Port             int `yaml:"port"`
-	HTTPPort         int `yaml:"httpPort"`
-	MaxConnections   int `yaml:"maxConnections"`
-	HeartbeatTimeout int `yaml:"heartbeatTimeout"`
+	Port               int    `yaml:"port"`
+	HTTPPort           int    `yaml:"httpPort"`
+	AdminPort          int    `yaml:"adminPort"`          // 管理接口端口，0 表示不启用
+	AdminHost          string `yaml:"adminHost"`          // 管理接口监听地址，为空时只监听 127.0.0.1
+	AdminToken         string `yaml:"adminToken"`         // 管理接口令牌，为空时不启用管理接口
+	MaxConnections     int    `yaml:"maxConnections"`     // 最大TCP连接数，0 表示不限制
+	HeartbeatTimeout   int    `yaml:"heartbeatTimeout"`   // 连接空闲超时(秒)
+	ShutdownTimeout    int    `yaml:"shutdownTimeout"`    // 退出时等待会话关闭、上报离线的最长时间(秒)
+	DisconnectCooldown int    `yaml:"disconnectCooldown"` // 平台断开设备后禁止重新注册的时间(秒)，0 表示不限制
 }
 
 type PlatformConfig struct {
@@ -20,6 +33,8 @@ type PlatformConfig struct {
 	MQTTUsername      string `yaml:"mqttUsername"` // MQTT用户名
 	MQTTPassword      string `yaml:"mqttPassword"` // MQTT密码
 	ServiceIdentifier string `yaml:"serviceIdentifier"`
+	QueueDir          string `yaml:"queueDir"`  // 遥测缓存队列目录，MQTT 不可用时暂存数据，为空时不缓存
+	QueueSize         int    `yaml:"queueSize"` // 遥测缓存队列容量(条)，满时丢弃最旧的数据
 }
 
 type LogConfig struct {
@@ -30,3 +45,76 @@ type LogConfig struct {
 	MaxAge     int    `yaml:"maxAge"`     // 保留日志文件的最大天数
 	Compress   bool   `yaml:"compress"`   // 是否压缩旧日志文件
 }
+
+// PollConfig 轮询配置，时间使用 "5s"、"200ms" 形式
+type PollConfig struct {
+	Gap      time.Duration       `yaml:"gap"`      // 两条指令之间的最小间隔
+	Timeout  time.Duration       `yaml:"timeout"`  // 默认应答超时
+	Commands []PollCommandConfig `yaml:"commands"` // 轮询指令列表
+	Devices  []DevicePollConfig  `yaml:"devices"`  // 按设备覆盖
+}
+
+type PollCommandConfig struct {
+	Command  string        `yaml:"command"`  // 指令，如 WA、Q6
+	Interval time.Duration `yaml:"interval"` // 轮询周期
+	Timeout  time.Duration `yaml:"timeout"`  // 应答超时，为0时使用 PollConfig.Timeout
+}
+
+type DevicePollConfig struct {
+	DeviceNumber string              `yaml:"deviceNumber"` // 设备编号
+	Gap          time.Duration       `yaml:"gap"`          // 为0时使用全局配置
+	Timeout      time.Duration       `yaml:"timeout"`      // 为0时使用全局配置
+	Commands     []PollCommandConfig `yaml:"commands"`     // 非空时替换全局指令列表
+}
+
+// ReportConfig 按变化上报配置，启用后只上报变化超过死区的遥测键
+type ReportConfig struct {
+	Enabled          bool             `yaml:"enabled"`
+	SnapshotInterval time.Duration    `yaml:"snapshotInterval"` // 强制上报全部最新值的周期，为0时不强制
+	Deadbands        []DeadbandConfig `yaml:"deadbands"`        // 未配置的键有任何变化即上报
+}
+
+// DeadbandConfig 遥测键的死区，分相键 "_l2"、"_l3" 使用不带后缀的配置。
+// 绝对值和百分比同时配置时任一超过即上报，状态位不使用死区。
+type DeadbandConfig struct {
+	Key      string  `yaml:"key"`
+	Absolute float64 `yaml:"absolute"` // 与上次上报值之差的绝对值
+	Percent  float64 `yaml:"percent"`  // 与上次上报值之差占上次上报值的百分比
+}
+
+// AggregateConfig 遥测聚合配置，数值在窗口内累计后上报最小、最大、平均值和最后一个值
+type AggregateConfig struct {
+	Window time.Duration `yaml:"window"` // 聚合窗口，为0时不聚合
+}
+
+// EnergyConfig 电能计量配置，按负载有功功率对时间积分
+type EnergyConfig struct {
+	File   string        `yaml:"file"`   // 计量数据文件，重启后继续累计，为空时不计量
+	MaxGap time.Duration `yaml:"maxGap"` // 两次功率采样间隔超过该时间时不积分该区间，为0时使用默认值
+}
+
+// BatteryConfig 电池后备时间估算和健康度跟踪配置
+type BatteryConfig struct {
+	Dir string `yaml:"dir"` // 放电校准数据和自检记录保存目录，为空时不保存
+}
+
+// BatteryTestConfig 定时电池自检配置
+type BatteryTestConfig struct {
+	Stagger   time.Duration        `yaml:"stagger"`   // 按设备错开执行时间的最大偏移，避免同一站点同时自检
+	Schedules []TestScheduleConfig `yaml:"schedules"` // 所有设备的自检计划
+	Devices   []DeviceTestConfig   `yaml:"devices"`   // 按设备覆盖
+}
+
+type TestScheduleConfig struct {
+	Name    string `yaml:"name"`
+	Cron    string `yaml:"cron"`    // 五段式 cron 表达式: 分 时 日 月 周
+	Method  string `yaml:"method"`  // 设备命令: test、test_until_low、test_minutes
+	Minutes int    `yaml:"minutes"` // test_minutes 的自检分钟数
+}
+
+type DeviceTestConfig struct {
+	DeviceNumber string               `yaml:"deviceNumber"` // 设备编号
+	Disabled     bool                 `yaml:"disabled"`     // 不执行定时自检
+	DeepTest     bool                 `yaml:"deepTest"`     // 执行 test_until_low 计划，深度放电需按设备开启
+	Schedules    []TestScheduleConfig `yaml:"schedules"`    // 非空时替换全局自检计划
+}
@@ -0,0 +1,154 @@
+// Package cron 解析五段式 cron 表达式(分 时 日 月 周)，计算下次执行时间。
+//
+// 每段支持 "*"、数字、范围 "a-b"、步长 "*/n"、"a-b/n" 以及逗号分隔的列表；
+// 周取值 0~7，0 和 7 都表示周日。日和周都不是 "*" 时满足其一即可，与常见 cron 实现一致。
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch 查找下次执行时间的最大范围，超出视为表达式永不触发(如 2月30日)
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// field 一段的取值范围
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{"分", 0, 59},
+	{"时", 0, 23},
+	{"日", 1, 31},
+	{"月", 1, 12},
+	{"周", 0, 7},
+}
+
+// Schedule 解析后的 cron 表达式，每段为取值的位集合
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool // 日、周为 "*"
+}
+
+// Parse 解析五段式 cron 表达式
+func Parse(spec string) (*Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron 表达式需要 %d 段，收到 %d 段: %q", len(fields), len(parts), spec)
+	}
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron 表达式 %q: %v", spec, err)
+		}
+		sets[i] = set
+	}
+	// 周日可以写作 0 或 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &Schedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseField 解析一段，返回取值的位集合
+func parseField(s string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rangePart, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: 步长无效 %q", f.name, item)
+			}
+			rangePart, step = item[:i], n
+		}
+		lo, hi := f.min, f.max
+		if rangePart != "*" {
+			var err error
+			if i := strings.IndexByte(rangePart, '-'); i >= 0 {
+				lo, err = strconv.Atoi(rangePart[:i])
+				if err == nil {
+					hi, err = strconv.Atoi(rangePart[i+1:])
+				}
+			} else {
+				lo, err = strconv.Atoi(rangePart)
+				hi = lo
+				if step > 1 {
+					// "a/n" 表示从 a 开始到最大值
+					hi = f.max
+				}
+			}
+			if err != nil {
+				return 0, fmt.Errorf("%s: 无效的值 %q", f.name, item)
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%s: 超出范围 %d~%d: %q", f.name, f.min, f.max, item)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// Next 返回 t 之后(不含 t 所在的分钟)第一个满足表达式的时间，使用 t 的时区；
+// 在 maxSearch 范围内找不到时返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(maxSearch)
+	for t.Before(end) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches 日和周都有限定时满足其一即可，否则按有限定的一段判断
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
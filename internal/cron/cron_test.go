@@ -0,0 +1,122 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+// bits 返回取值的位集合
+func bits(values ...int) uint64 {
+	var set uint64
+	for _, v := range values {
+		set |= 1 << uint(v)
+	}
+	return set
+}
+
+func TestParseField(t *testing.T) {
+	minute, hour, dow := fields[0], fields[1], fields[4]
+	tests := []struct {
+		spec string
+		f    field
+		want uint64
+	}{
+		{"*", hour, 1<<24 - 1},
+		{"7", minute, bits(7)},
+		{"5,10-12", minute, bits(5, 10, 11, 12)},
+		{"*/15", minute, bits(0, 15, 30, 45)},
+		{"10-30/10", minute, bits(10, 20, 30)},
+		{"5/20", minute, bits(5, 25, 45)},
+		{"1-5,0", dow, bits(0, 1, 2, 3, 4, 5)},
+	}
+	for _, tt := range tests {
+		got, err := parseField(tt.spec, tt.f)
+		if err != nil {
+			t.Errorf("%s(%s): %v", tt.f.name, tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s(%s) = %b, 期望 %b", tt.f.name, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	s, err := Parse("0 3 1,15 * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.dow != bits(0, 7) {
+		t.Errorf("周 7 = %b, 期望同时匹配 0", s.dow)
+	}
+	if s.domAny || s.dowAny {
+		t.Error("日和周都有限定")
+	}
+
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) 期望返回错误", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2026-01-01 为周四
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"当天稍后", "0 3 1 * *", at(1, 1, 2, 59).Add(30 * time.Second), at(1, 1, 3, 0)},
+		{"不含当前分钟", "0 3 1 * *", at(1, 1, 3, 0), at(2, 1, 3, 0)},
+		{"分钟步长", "*/15 * * * *", at(1, 1, 10, 7), at(1, 1, 10, 15)},
+		{"小时范围步长", "0 8-18/5 * * *", at(1, 1, 9, 0), at(1, 1, 13, 0)},
+		{"月份列表", "0 3 15 1,4,7,10 *", at(1, 20, 0, 0), at(4, 15, 3, 0)},
+		{"跨年", "0 0 1 1 *", at(6, 1, 0, 0), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"只限定周", "0 4 * * 0", at(1, 1, 0, 0), at(1, 4, 4, 0)},
+		{"周日写作 7", "0 4 * * 7", at(1, 1, 0, 0), at(1, 4, 4, 0)},
+		{"只限定日", "0 0 13 * *", at(1, 1, 0, 0), at(1, 13, 0, 0)},
+		{"日和周满足周", "0 0 13 * 5", at(1, 1, 0, 0), at(1, 2, 0, 0)},
+		{"日和周满足日", "0 0 13 * 5", at(1, 10, 0, 0), at(1, 13, 0, 0)},
+		{"永不触发", "0 0 30 2 *", at(1, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%s: Next(%s) = %s, 期望 %s", tt.name, tt.from.Format(time.DateTime), got, tt.want)
+		}
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	s, err := Parse("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.Next(time.Date(2026, 1, 1, 12, 0, 0, 0, loc))
+	if want := time.Date(2026, 1, 2, 3, 0, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next = %s, 期望按设定时区 %s", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+// Package energy 按设备对负载有功功率积分，累计总电能和当日电能，并保存到文件。
+package energy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxGap = 2 * time.Minute // 未配置最大采样间隔时使用
+	saveInterval  = time.Minute     // 计量数据写入文件的最小间隔
+	dayLayout     = "2006-01-02"
+)
+
+// 发布的遥测键，单位 kWh
+const (
+	KeyTotal = "energytotal"
+	KeyDaily = "energydaily"
+)
+
+// Counter 单个设备的计量数据
+type Counter struct {
+	TotalKWh  float64   `json:"total_kwh"`
+	DailyKWh  float64   `json:"daily_kwh"`
+	Day       string    `json:"day"`        // DailyKWh 所属日期，本地时间
+	LastTime  time.Time `json:"last_time"`  // 上次功率采样时间
+	LastPower float64   `json:"last_power"` // 上次功率采样值，kW
+}
+
+// Meter 按设备累计电能，并发安全
+type Meter struct {
+	path   string
+	maxGap time.Duration
+
+	mu       sync.Mutex
+	counters map[string]*Counter
+	dirty    bool
+	lastSave time.Time
+}
+
+// Open 加载计量数据文件，文件不存在时从零开始
+func Open(path string, maxGap time.Duration) (*Meter, error) {
+	if maxGap <= 0 {
+		maxGap = defaultMaxGap
+	}
+	m := &Meter{path: path, maxGap: maxGap, counters: make(map[string]*Counter)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取计量数据失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &m.counters); err != nil {
+		return nil, fmt.Errorf("解析计量数据失败: %v", err)
+	}
+	return m, nil
+}
+
+// Add 记录一次功率采样(kW)，按梯形法对与上次采样之间的时间积分，返回累计的总电能和当日电能(kWh)。
+// 与上次采样间隔超过 maxGap (如断线重连)时该区间不积分。跨越零点的区间按时间比例分到两天。
+// err 为定期写入文件的错误，计量本身不受影响，下次写入时重试。
+func (m *Meter) Add(deviceID string, power float64, now time.Time) (total, daily float64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.counters[deviceID]
+	if !ok {
+		c = &Counter{}
+		m.counters[deviceID] = c
+	}
+	today := now.Format(dayLayout)
+	if dt := now.Sub(c.LastTime); !c.LastTime.IsZero() && dt > 0 && dt <= m.maxGap {
+		energy := (c.LastPower + power) / 2 * dt.Hours()
+		c.TotalKWh += energy
+		if c.Day == today {
+			c.DailyKWh += energy
+		} else {
+			// 只计入零点之后的部分
+			midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+			c.DailyKWh = energy * now.Sub(midnight).Hours() / dt.Hours()
+			if c.DailyKWh > energy {
+				c.DailyKWh = energy
+			}
+		}
+	} else if c.Day != today {
+		c.DailyKWh = 0
+	}
+	c.Day = today
+	c.LastTime = now
+	c.LastPower = power
+	m.dirty = true
+	if now.Sub(m.lastSave) >= saveInterval {
+		err = m.saveLocked(now)
+	}
+	return round(c.TotalKWh), round(c.DailyKWh), err
+}
+
+// Save 将计量数据写入文件，插件退出时调用
+func (m *Meter) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saveLocked(time.Now())
+}
+
+// saveLocked 先写临时文件再替换，避免写入中断损坏数据，调用方持有锁
+func (m *Meter) saveLocked(now time.Time) error {
+	if !m.dirty {
+		return nil
+	}
+	m.lastSave = now
+	data, err := json.MarshalIndent(m.counters, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化计量数据失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("创建计量数据目录失败: %v", err)
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入计量数据失败: %v", err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("替换计量数据文件失败: %v", err)
+	}
+	m.dirty = false
+	return nil
+}
+
+// round 保留3位小数，即 1Wh
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
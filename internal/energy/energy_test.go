@@ -0,0 +1,110 @@
+package energy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// at 返回 2024-05-01 当地时间的时刻
+func at(hour, min int) time.Time {
+	return time.Date(2024, 5, 1, hour, min, 0, 0, time.Local)
+}
+
+func openMeter(t *testing.T, path string) *Meter {
+	t.Helper()
+	m, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func add(t *testing.T, m *Meter, id string, power float64, now time.Time) (float64, float64) {
+	t.Helper()
+	total, daily, err := m.Add(id, power, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return total, daily
+}
+
+func TestAddTrapezoid(t *testing.T) {
+	m := openMeter(t, filepath.Join(t.TempDir(), "energy.json"))
+	if total, daily := add(t, m, "dev", 3, at(10, 0)); total != 0 || daily != 0 {
+		t.Fatalf("首次采样 = %v %v, 期望 0", total, daily)
+	}
+	// (3 + 9) / 2 kW × 1 分钟 = 0.1 kWh
+	if total, daily := add(t, m, "dev", 9, at(10, 1)); total != 0.1 || daily != 0.1 {
+		t.Errorf("第二次采样 = %v %v, 期望 0.1 0.1", total, daily)
+	}
+	// 设备之间互不影响
+	if total, _ := add(t, m, "other", 9, at(10, 1)); total != 0 {
+		t.Errorf("其他设备 total = %v, 期望 0", total)
+	}
+}
+
+func TestAddGap(t *testing.T) {
+	m := openMeter(t, filepath.Join(t.TempDir(), "energy.json"))
+	add(t, m, "dev", 6, at(10, 0))
+	add(t, m, "dev", 6, at(10, 1)) // 0.1 kWh
+	// 断线 5 分钟，超过默认最大间隔，该区间不积分
+	if total, daily := add(t, m, "dev", 6, at(10, 6)); total != 0.1 || daily != 0.1 {
+		t.Errorf("间隔过长后 = %v %v, 期望 0.1 0.1", total, daily)
+	}
+	// 重新开始积分
+	if total, _ := add(t, m, "dev", 6, at(10, 7)); total != 0.2 {
+		t.Errorf("恢复采样后 total = %v, 期望 0.2", total)
+	}
+}
+
+func TestAddMidnight(t *testing.T) {
+	m := openMeter(t, filepath.Join(t.TempDir(), "energy.json"))
+	day1 := time.Date(2024, 5, 1, 23, 59, 0, 0, time.Local)
+	add(t, m, "dev", 6, day1.Add(-time.Minute))
+	add(t, m, "dev", 6, day1) // 0.1 kWh
+	// 23:59 ~ 00:01 共 0.2 kWh，零点之后的一半计入新的一天
+	total, daily := add(t, m, "dev", 6, day1.Add(2*time.Minute))
+	if total != 0.3 || daily != 0.1 {
+		t.Errorf("跨零点 = %v %v, 期望 0.3 0.1", total, daily)
+	}
+
+	// 跨零点且间隔过长时当日电能清零
+	m2 := openMeter(t, filepath.Join(t.TempDir(), "energy.json"))
+	add(t, m2, "dev", 6, day1.Add(-time.Minute))
+	add(t, m2, "dev", 6, day1)
+	total, daily = add(t, m2, "dev", 6, day1.Add(time.Hour))
+	if total != 0.1 || daily != 0 {
+		t.Errorf("跨零点断线 = %v %v, 期望 0.1 0", total, daily)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "energy.json")
+	m := openMeter(t, path)
+	add(t, m, "dev", 6, at(10, 0))
+	add(t, m, "dev", 6, at(10, 1))
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后继续累计，1 分钟内恢复采样时该区间也计入
+	m = openMeter(t, path)
+	total, daily := add(t, m, "dev", 6, at(10, 2))
+	if total != 0.2 || daily != 0.2 {
+		t.Errorf("重启后 = %v %v, 期望 0.2 0.2", total, daily)
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "energy.json")
+	m := openMeter(t, path)
+	add(t, m, "dev", 6, at(10, 0))
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, 0); err == nil {
+		t.Error("计量数据文件损坏时 Open 应返回错误，避免覆盖已有数据")
+	}
+}
@@ -3,11 +3,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"time"
 	formjson "tp-santak-rtu/internal/form_json"
 	"tp-santak-rtu/internal/platform"
+	"tp-santak-rtu/internal/protocol"
+	"tp-santak-rtu/internal/tcpserver"
 
 	"github.com/ThingsPanel/tp-protocol-sdk-go/handler"
 	"github.com/sirupsen/logrus"
@@ -26,18 +30,22 @@ func (w *logrusWriter) Write(p []byte) (n int, err error) {
 // HTTPHandler HTTP服务处理器
 type HTTPHandler struct {
 	platform *platform.PlatformClient
+	tcp      *tcpserver.TCPServer
+	cooldown time.Duration // 平台断开设备后禁止重新注册的时间
 	logger   *logrus.Logger
 	stdlog   *log.Logger
 }
 
 // NewHTTPHandler 创建HTTP处理器
-func NewHTTPHandler(platform *platform.PlatformClient, logger *logrus.Logger) *HTTPHandler {
+func NewHTTPHandler(platform *platform.PlatformClient, tcp *tcpserver.TCPServer, cooldown time.Duration, logger *logrus.Logger) *HTTPHandler {
 	// 创建适配器
 	writer := &logrusWriter{logger: logger}
 	stdlog := log.New(writer, "[HTTP] ", log.Ldate|log.Ltime|log.Lshortfile)
 
 	return &HTTPHandler{
 		platform: platform,
+		tcp:      tcp,
+		cooldown: cooldown,
 		logger:   logger,
 		stdlog:   stdlog,
 	}
@@ -77,7 +85,7 @@ func (h *HTTPHandler) handleGetFormConfig(req *handler.GetFormConfigRequest) (in
 		// 根据请求类型返回不同的配置表单
 		switch req.FormType {
 		case "CFG": // 设备配置表单
-			return nil, nil
+			return readFormConfigByPath("../internal/form_json/form_config.json"), nil
 		case "VCR": // 设备凭证表单
 			return readFormConfigByPath("../internal/form_json/form_voucher.json"), nil
 		case "VCRT": // 设备凭证表单
@@ -113,7 +121,7 @@ func readFormConfigByPath(path string) interface{} {
 	}
 }
 
-// handleDeviceDisconnect 处理设备断开连接请求
+// handleDeviceDisconnect 处理设备断开连接请求，关闭设备的TCP会话，会话退出时上报离线
 func (h *HTTPHandler) handleDeviceDisconnect(req *handler.DeviceDisconnectRequest) error {
 	h.logger.WithField("device_id", req.DeviceID).Info("收到设备断开连接请求")
 
@@ -124,13 +132,10 @@ func (h *HTTPHandler) handleDeviceDisconnect(req *handler.DeviceDisconnectReques
 		h.platform.ClearDeviceCache(device.DeviceNumber)
 	}
 
-	// 发送设备离线状态
-	err = h.platform.SendDeviceStatus(req.DeviceID, "0")
-	if err != nil {
-		h.logger.WithError(err).Error("发送设备离线状态失败")
+	if err := h.tcp.DisconnectDevice(req.DeviceID, h.cooldown); err != nil {
+		h.logger.WithError(err).WithField("device_id", req.DeviceID).Warn("断开设备失败")
 		return err
 	}
-
 	return nil
 }
 
@@ -141,21 +146,20 @@ func (h *HTTPHandler) handleNotification(req *handler.NotificationRequest) error
 		"message":      req.Message,
 	}).Info("收到通知请求")
 
-	// 解析消息内容
-	var msgData map[string]interface{}
-	if err := json.Unmarshal([]byte(req.Message), &msgData); err != nil {
-		h.logger.WithError(err).Error("解析通知消息失败")
-		return err
-	}
-
 	// 处理不同类型的通知
 	switch req.MessageType {
 	case "1": // 服务配置修改
 		h.logger.Info("处理服务配置修改通知")
-		// TODO: 实现服务配置修改逻辑
+		return h.handleServiceConfigChange()
 	case "2": // 设备配置修改
 		h.logger.Info("处理设备配置修改通知")
-		// TODO: 实现设备配置修改逻辑
+		// 解析消息内容
+		var msgData map[string]interface{}
+		if err := json.Unmarshal([]byte(req.Message), &msgData); err != nil {
+			h.logger.WithError(err).Error("解析通知消息失败")
+			return err
+		}
+		return h.handleDeviceConfigChange(msgData)
 	default:
 		h.logger.Warnf("未知的通知类型: %s", req.MessageType)
 	}
@@ -163,6 +167,42 @@ func (h *HTTPHandler) handleNotification(req *handler.NotificationRequest) error
 	return nil
 }
 
+// handleServiceConfigChange 服务配置修改：刷新服务接入点，设备配置全部重新获取。
+// 接入点刷新失败时仍重新加载设备配置，并把错误返回给平台。
+func (h *HTTPHandler) handleServiceConfigChange() error {
+	_, err := h.platform.RefreshServiceAccessPoints()
+	if err != nil {
+		h.logger.WithError(err).Error("刷新服务接入点失败")
+	}
+	h.platform.ClearAllDeviceCache()
+	for _, info := range h.tcp.Sessions() {
+		h.reloadDevice(info.DeviceID)
+	}
+	return err
+}
+
+// handleDeviceConfigChange 设备配置修改：清理设备缓存，并把新配置应用到在线会话
+func (h *HTTPHandler) handleDeviceConfigChange(msgData map[string]interface{}) error {
+	deviceID, _ := msgData["device_id"].(string)
+	if deviceID == "" {
+		return fmt.Errorf("通知消息缺少device_id")
+	}
+	h.platform.ClearDeviceCacheByID(deviceID)
+	h.reloadDevice(deviceID)
+	return nil
+}
+
+// reloadDevice 重新加载在线设备的配置，设备不在线时下次注册自然使用新配置
+func (h *HTTPHandler) reloadDevice(deviceID string) {
+	err := h.tcp.ReloadDevice(deviceID)
+	switch {
+	case errors.Is(err, tcpserver.ErrDeviceNotConnected):
+		h.logger.Infof("设备 %s 不在线，下次注册时使用新配置", deviceID)
+	case err != nil:
+		h.logger.WithError(err).Errorf("设备 %s 重新加载配置失败", deviceID)
+	}
+}
+
 // handleGetDeviceList 处理获取设备列表请求
 func (h *HTTPHandler) handleGetDeviceList(req *handler.GetDeviceListRequest) (*handler.DeviceListResponse, error) {
 	h.logger.WithFields(logrus.Fields{
@@ -179,10 +219,57 @@ func (h *HTTPHandler) handleGetDeviceList(req *handler.GetDeviceListRequest) (*h
 		return nil, err
 	}
 
+	discovered := h.tcp.Discovered()
 	rsp := handler.DeviceListResponse{
 		Code:    200,
 		Message: "获取成功",
+		Data: handler.DeviceListData{
+			List:  []handler.DeviceItem{},
+			Total: len(discovered),
+		},
+	}
+	start, end := pageRange(req.Page, req.PageSize, len(discovered))
+	for _, dev := range discovered[start:end] {
+		rsp.Data.List = append(rsp.Data.List, discoveredItem(dev))
 	}
 
 	return &rsp, nil
 }
+
+// pageRange 计算分页的切片范围，页码从1开始，每页数量不大于0时返回全部
+func pageRange(page, pageSize, total int) (start, end int) {
+	if pageSize <= 0 {
+		return 0, total
+	}
+	if page < 1 {
+		page = 1
+	}
+	start = (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end = start + pageSize
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// discoveredItem 将未绑定的 DTU 转换为设备列表项，设备编号即注册包
+func discoveredItem(dev tcpserver.DiscoveredDevice) handler.DeviceItem {
+	desc := fmt.Sprintf("地址: %s, 首次: %s, 最近: %s, 注册次数: %d",
+		dev.RemoteAddr,
+		dev.FirstSeen.Format("2006-01-02 15:04:05"),
+		dev.LastSeen.Format("2006-01-02 15:04:05"),
+		dev.Count)
+	for _, cmd := range []string{protocol.CmdQ6, protocol.CmdWA} {
+		if frame, ok := dev.Samples[cmd]; ok {
+			desc += fmt.Sprintf(", %s: %s", cmd, frame)
+		}
+	}
+	return handler.DeviceItem{
+		DeviceName:   "SANTAK-RTU " + dev.RegPacket,
+		Description:  desc,
+		DeviceNumber: dev.RegPacket,
+	}
+}
@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tp-santak-rtu/internal/config"
+	"tp-santak-rtu/internal/platform"
+	"tp-santak-rtu/internal/tcpserver"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakePlatform 模拟平台接口：按凭证返回设备并统计请求次数，返回服务接入点列表
+type fakePlatform struct {
+	devices      map[string]string // voucher -> device_id
+	accessPoints []string          // 服务接入点名称
+	accessFail   atomic.Bool       // 服务接入点接口返回错误
+	requests     atomic.Int64      // 设备配置请求次数
+}
+
+func (f *fakePlatform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v1/plugin/service/access/list" {
+		if f.accessFail.Load() {
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": 500, "message": "error"})
+			return
+		}
+		points := make([]map[string]interface{}, 0, len(f.accessPoints))
+		for _, name := range f.accessPoints {
+			points = append(points, map[string]interface{}{"id": name, "name": name})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "message": "success", "data": points})
+		return
+	}
+
+	f.requests.Add(1)
+	var req struct {
+		Voucher string `json:"voucher"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    200,
+		"message": "success",
+		"data": map[string]interface{}{
+			"id":            f.devices[req.Voucher],
+			"voucher":       req.Voucher,
+			"device_number": req.Voucher,
+		},
+	})
+}
+
+func newTestHandler(t *testing.T) (http.Handler, *platform.PlatformClient, *fakePlatform) {
+	t.Helper()
+	h, p, fake, _ := newTestHandlerOpts(t, tcpserver.Options{})
+	return h, p, fake
+}
+
+// newTestHandlerOpts 同 newTestHandler，按 opts 创建 TCP 服务器并一同返回
+func newTestHandlerOpts(t *testing.T, opts tcpserver.Options) (http.Handler, *platform.PlatformClient, *fakePlatform, *tcpserver.TCPServer) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	fake := &fakePlatform{
+		devices: map[string]string{
+			"voucher-a": "dev-a",
+			"voucher-b": "dev-b",
+		},
+		accessPoints: []string{"机房A", "机房B"},
+	}
+	api := httptest.NewServer(fake)
+	t.Cleanup(api.Close)
+
+	p, err := platform.New(platform.Config{BaseURL: api.URL}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	tcp, err := tcpserver.NewTCPServer(p, opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHTTPHandler(p, tcp, time.Minute, logger)
+	return h.RegisterHandlers(), p, fake, tcp
+}
+
+// notify 发送平台通知，返回响应中的 code
+func notify(t *testing.T, h http.Handler, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/plugin/notification", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var rsp struct {
+		Code int `json:"code"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&rsp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return rsp.Code
+}
+
+// cached 查询设备并返回本次查询是否命中缓存
+func cached(t *testing.T, p *platform.PlatformClient, fake *fakePlatform, voucher string) bool {
+	t.Helper()
+	before := fake.requests.Load()
+	if _, err := p.GetDeviceByVoucher(voucher); err != nil {
+		t.Fatal(err)
+	}
+	return fake.requests.Load() == before
+}
+
+// accessPointNames 返回缓存的服务接入点名称
+func accessPointNames(p *platform.PlatformClient) []string {
+	var names []string
+	for _, point := range p.ServiceAccessPoints() {
+		names = append(names, point.Name)
+	}
+	return names
+}
+
+func TestNotificationServiceConfigChange(t *testing.T) {
+	h, p, fake := newTestHandler(t)
+	cached(t, p, fake, "voucher-a")
+	cached(t, p, fake, "voucher-b")
+
+	for _, body := range []string{
+		`{"message_type":"1","message":"{\"service_identifier\":\"SANTAK-RTU\"}"}`,
+		`{"message_type":"1"}`,
+	} {
+		if code := notify(t, h, body); code != http.StatusOK {
+			t.Fatalf("%s: code = %d", body, code)
+		}
+		if cached(t, p, fake, "voucher-a") || cached(t, p, fake, "voucher-b") {
+			t.Errorf("%s: 服务配置修改后设备缓存未清理", body)
+		}
+	}
+	if got := accessPointNames(p); !reflect.DeepEqual(got, []string{"机房A", "机房B"}) {
+		t.Errorf("服务接入点 = %v, 期望 [机房A 机房B]", got)
+	}
+}
+
+func TestNotificationServiceAccessPointsRefresh(t *testing.T) {
+	h, p, fake := newTestHandler(t)
+	body := `{"message_type":"1"}`
+	if code := notify(t, h, body); code != http.StatusOK {
+		t.Fatalf("code = %d", code)
+	}
+
+	// 平台新增接入点后再次通知
+	fake.accessPoints = []string{"机房A", "机房B", "机房C"}
+	if code := notify(t, h, body); code != http.StatusOK {
+		t.Fatalf("code = %d", code)
+	}
+	if got := accessPointNames(p); !reflect.DeepEqual(got, []string{"机房A", "机房B", "机房C"}) {
+		t.Errorf("服务接入点 = %v, 期望刷新为 [机房A 机房B 机房C]", got)
+	}
+
+	// 刷新失败时保留上次的接入点，设备缓存照常清理
+	cached(t, p, fake, "voucher-a")
+	fake.accessFail.Store(true)
+	if code := notify(t, h, body); code != http.StatusInternalServerError {
+		t.Errorf("刷新失败时 code = %d, 期望 500", code)
+	}
+	if len(p.ServiceAccessPoints()) != 3 {
+		t.Errorf("刷新失败后接入点 = %v, 期望保留上次结果", accessPointNames(p))
+	}
+	if cached(t, p, fake, "voucher-a") {
+		t.Error("刷新接入点失败时设备缓存也应清理")
+	}
+}
+
+func TestNotificationDeviceConfigChange(t *testing.T) {
+	h, p, fake := newTestHandler(t)
+	cached(t, p, fake, "voucher-a")
+	cached(t, p, fake, "voucher-b")
+
+	body := `{"message_type":"2","message":"{\"device_id\":\"dev-a\",\"device_number\":\"voucher-a\"}"}`
+	if code := notify(t, h, body); code != http.StatusOK {
+		t.Fatalf("code = %d", code)
+	}
+	if cached(t, p, fake, "voucher-a") {
+		t.Error("dev-a 的缓存未清理")
+	}
+	if !cached(t, p, fake, "voucher-b") {
+		t.Error("dev-b 的缓存不应清理")
+	}
+}
+
+func TestNotificationInvalid(t *testing.T) {
+	h, _, _ := newTestHandler(t)
+	for _, body := range []string{
+		`{"message_type":"2","message":"{}"}`,
+		`{"message_type":"2","message":"not json"}`,
+	} {
+		if code := notify(t, h, body); code != http.StatusInternalServerError {
+			t.Errorf("%s: code = %d, 期望 500", body, code)
+		}
+	}
+	if code := notify(t, h, `{"message_type":"9","message":""}`); code != http.StatusOK {
+		t.Errorf("未知通知类型: code = %d, 期望 200", code)
+	}
+}
+
+// freePort 返回一个空闲的本地端口
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return fmt.Sprint(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// registerDTU 模拟未绑定的 DTU 注册，按 replies 应答采样指令，直到服务器断开连接
+func registerDTU(t *testing.T, port, reg string, replies map[string]string) {
+	t.Helper()
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", "127.0.0.1:"+port); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(reg)); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	for {
+		cmd, err := r.ReadString('\r')
+		if err != nil {
+			return
+		}
+		if reply, ok := replies[strings.TrimSuffix(cmd, "\r")]; ok {
+			conn.Write([]byte(reply + "\r"))
+		}
+	}
+}
+
+// deviceList 请求设备列表
+func deviceList(t *testing.T, h http.Handler, page, pageSize int) (list []map[string]string, total int) {
+	t.Helper()
+	url := fmt.Sprintf("/api/v1/plugin/device/list?voucher=%s&page=%d&page_size=%d", `{}`, page, pageSize)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	var rsp struct {
+		Code int `json:"code"`
+		Data struct {
+			List  []map[string]string `json:"list"`
+			Total int                 `json:"total"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&rsp); err != nil || rsp.Code != http.StatusOK {
+		t.Fatalf("设备列表: code = %d, err = %v", rsp.Code, err)
+	}
+	return rsp.Data.List, rsp.Data.Total
+}
+
+func TestGetDeviceListDiscovered(t *testing.T) {
+	port := freePort(t)
+	h, _, _, tcp := newTestHandlerOpts(t, tcpserver.Options{
+		Port: port,
+		Poll: config.PollConfig{Timeout: 200 * time.Millisecond},
+	})
+	go tcp.Start()
+	t.Cleanup(func() { tcp.Shutdown(context.Background()) })
+
+	const q6 = "(229.8 ---.- ---.- 50.0 220.1 ---.- ---.- 50.0 229.8 ---.- ---.- 081.6 ---.- 50.0 0045 100 025.0 031.0 -- --"
+	registerDTU(t, port, "NEW-DTU-1", map[string]string{"Q6": q6})
+	registerDTU(t, port, "NEW-DTU-2", nil)
+	registerDTU(t, port, "NEW-DTU-2", nil)
+
+	list, total := deviceList(t, h, 1, 10)
+	if total != 2 || len(list) != 2 {
+		t.Fatalf("total = %d, list = %v, 期望 2 台未绑定 DTU", total, list)
+	}
+	// 最近出现的在前
+	if list[0]["device_number"] != "NEW-DTU-2" || list[1]["device_number"] != "NEW-DTU-1" {
+		t.Errorf("设备编号 = %s, %s, 期望 NEW-DTU-2, NEW-DTU-1", list[0]["device_number"], list[1]["device_number"])
+	}
+	if !strings.Contains(list[0]["description"], "注册次数: 2") {
+		t.Errorf("NEW-DTU-2 描述 = %q, 期望注册次数 2", list[0]["description"])
+	}
+	if !strings.Contains(list[1]["description"], "Q6: "+q6) || strings.Contains(list[1]["description"], "WA:") {
+		t.Errorf("NEW-DTU-1 描述 = %q, 期望只包含 Q6 采样", list[1]["description"])
+	}
+
+	list, total = deviceList(t, h, 2, 1)
+	if total != 2 || len(list) != 1 || list[0]["device_number"] != "NEW-DTU-1" {
+		t.Errorf("第2页 = %v, total = %d, 期望 NEW-DTU-1", list, total)
+	}
+	if list, _ = deviceList(t, h, 3, 1); len(list) != 0 {
+		t.Errorf("超出范围的页 = %v, 期望为空", list)
+	}
+}
@@ -6,20 +6,35 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
 	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/sirupsen/logrus"
 )
 
+// telemetryTopic 遥测数据主题
+const telemetryTopic = "devices/telemetry"
+
 // PlatformClient 平台客户端
 type PlatformClient struct {
 	sdkClient   *client.Client
 	logger      *logrus.Logger
 	deviceCache map[string]*types.Device
 	cacheMutex  sync.RWMutex
+
+	accessPoints []types.ServiceAccessRsp // 服务接入点缓存
+	accessMutex  sync.RWMutex
+
+	queue *telemetryQueue // 遥测发布失败时的缓存队列，nil 表示不缓存
+	done  chan struct{}
+
+	config   Config
+	commands mqtt.Client // 设备命令订阅连接，未订阅时为 nil
 }
 
 // Config 平台配置
@@ -28,10 +43,25 @@ type Config struct {
 	MQTTBroker   string
 	MQTTUsername string
 	MQTTPassword string
+	QueueDir     string // 遥测缓存队列目录，为空时不缓存
+	QueueSize    int    // 遥测缓存队列容量(条)
 }
 
-// NewPlatformClient 创建平台客户端
+// NewPlatformClient 创建平台客户端并连接 MQTT 服务器
 func NewPlatformClient(config Config, logger *logrus.Logger) (*PlatformClient, error) {
+	p, err := New(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Connect(); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// New 创建平台客户端，不连接 MQTT 服务器，连接前发布消息返回未连接错误
+func New(config Config, logger *logrus.Logger) (*PlatformClient, error) {
 	sdkConfig := client.ClientConfig{
 		BaseURL:      config.BaseURL,
 		MQTTBroker:   config.MQTTBroker,
@@ -45,15 +75,30 @@ func NewPlatformClient(config Config, logger *logrus.Logger) (*PlatformClient, e
 		return nil, err
 	}
 
-	if err := sdkClient.Connect(); err != nil {
-		return nil, err
-	}
-
-	return &PlatformClient{
+	p := &PlatformClient{
 		sdkClient:   sdkClient,
 		logger:      logger,
+		config:      config,
 		deviceCache: make(map[string]*types.Device),
-	}, nil
+		done:        make(chan struct{}),
+	}
+	if config.QueueDir != "" {
+		if p.queue, err = openTelemetryQueue(config.QueueDir, config.QueueSize); err != nil {
+			sdkClient.Close()
+			return nil, fmt.Errorf("打开遥测缓存队列失败: %v", err)
+		}
+		logger.WithFields(logrus.Fields{
+			"dir":   config.QueueDir,
+			"depth": p.queue.len(),
+		}).Info("遥测缓存队列已启用")
+		go p.replayLoop()
+	}
+	return p, nil
+}
+
+// Connect 连接 MQTT 服务器，SDK 断线后自动重连
+func (p *PlatformClient) Connect() error {
+	return p.sdkClient.Connect()
 }
 
 // GetDevice 获取设备信息(带缓存)
@@ -128,6 +173,26 @@ func (p *PlatformClient) GetServiceAccessPoints() ([]types.ServiceAccessRsp, err
 	return resp.Data, nil
 }
 
+// RefreshServiceAccessPoints 重新获取服务接入点列表并缓存，服务配置修改后调用
+func (p *PlatformClient) RefreshServiceAccessPoints() ([]types.ServiceAccessRsp, error) {
+	points, err := p.GetServiceAccessPoints()
+	if err != nil {
+		return nil, err
+	}
+	p.accessMutex.Lock()
+	p.accessPoints = points
+	p.accessMutex.Unlock()
+	p.logger.WithField("count", len(points)).Info("服务接入点已刷新")
+	return points, nil
+}
+
+// ServiceAccessPoints 返回最近一次刷新的服务接入点列表
+func (p *PlatformClient) ServiceAccessPoints() []types.ServiceAccessRsp {
+	p.accessMutex.RLock()
+	defer p.accessMutex.RUnlock()
+	return p.accessPoints
+}
+
 // ClearDeviceCache 清理指定设备的缓存
 func (p *PlatformClient) ClearDeviceCache(deviceNumber string) {
 	p.cacheMutex.Lock()
@@ -144,6 +209,26 @@ func (p *PlatformClient) ClearDeviceCacheByVoucher(Voucher string) {
 	p.logger.WithField("voucher", Voucher).Debug("设备缓存已清理")
 }
 
+// ClearDeviceCacheByID 清理设备ID对应的所有缓存，设备可能同时以编号和凭证缓存
+func (p *PlatformClient) ClearDeviceCacheByID(deviceID string) {
+	p.cacheMutex.Lock()
+	for key, device := range p.deviceCache {
+		if device.ID == deviceID {
+			delete(p.deviceCache, key)
+		}
+	}
+	p.cacheMutex.Unlock()
+	p.logger.WithField("device_id", deviceID).Debug("设备缓存已清理")
+}
+
+// ClearAllDeviceCache 清理全部设备缓存
+func (p *PlatformClient) ClearAllDeviceCache() {
+	p.cacheMutex.Lock()
+	p.deviceCache = make(map[string]*types.Device)
+	p.cacheMutex.Unlock()
+	p.logger.Debug("全部设备缓存已清理")
+}
+
 // GetDeviceByID 通过设备ID查找设备
 func (p *PlatformClient) GetDeviceByID(deviceID string) (*types.Device, error) {
 	var foundDevice *types.Device
@@ -163,6 +248,121 @@ func (p *PlatformClient) GetDeviceByID(deviceID string) (*types.Device, error) {
 
 // SendTelemetry 发送遥测数据
 func (p *PlatformClient) SendTelemetry(deviceID string, values map[string]interface{}) error {
+	if p.queue != nil && p.queue.len() > 0 {
+		// 队列中还有未补发的数据，排在其后以保持顺序
+		return p.enqueueTelemetry(deviceID, values)
+	}
+	if err := p.publishValues(telemetryTopic, deviceID, values, time.Time{}); err != nil {
+		if p.queue == nil {
+			return err
+		}
+		p.logger.WithError(err).WithField("device_id", deviceID).Warn("遥测数据发送失败，写入缓存队列")
+		return p.enqueueTelemetry(deviceID, values)
+	}
+	p.logger.WithFields(logrus.Fields{
+		"device_id": deviceID,
+	}).Debug("遥测数据发送成功")
+	return nil
+}
+
+// enqueueTelemetry 将遥测数据连同采集时间写入缓存队列
+func (p *PlatformClient) enqueueTelemetry(deviceID string, values map[string]interface{}) error {
+	return p.queue.push(queuedTelemetry{
+		DeviceID: deviceID,
+		Ts:       time.Now().UnixMilli(),
+		Values:   values,
+	})
+}
+
+// replayLoop 定期按入队顺序补发缓存的遥测数据，直到 Close
+func (p *PlatformClient) replayLoop() {
+	ticker := time.NewTicker(queueReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.replayTelemetry()
+		}
+	}
+}
+
+// replayTelemetry 补发缓存的遥测数据，遇到发送失败时停止，等待下个周期重试
+func (p *PlatformClient) replayTelemetry() {
+	total := 0
+	defer func() {
+		if total > 0 {
+			p.logger.WithFields(logrus.Fields{
+				"replayed": total,
+				"depth":    p.queue.len(),
+			}).Info("缓存遥测数据补发完成")
+		}
+	}()
+	for {
+		batch := p.queue.peek(queueReplayBatch)
+		if len(batch) == 0 || !p.sdkClient.MQTT().IsConnected() {
+			return
+		}
+		sent := 0
+		var err error
+		for _, e := range batch {
+			if err = p.publishValues(telemetryTopic, e.DeviceID, e.Values, time.UnixMilli(e.Ts)); err != nil {
+				break
+			}
+			sent++
+		}
+		if sent > 0 {
+			if ackErr := p.queue.ack(batch[sent-1].Seq, sent); ackErr != nil {
+				p.logger.WithError(ackErr).Error("更新遥测缓存队列失败")
+			}
+			total += sent
+		}
+		if err != nil {
+			p.logger.WithError(err).Warn("补发缓存遥测数据失败")
+			return
+		}
+	}
+}
+
+// QueueStats 返回遥测缓存队列统计
+func (p *PlatformClient) QueueStats() QueueStats {
+	if p.queue == nil {
+		return QueueStats{}
+	}
+	return p.queue.stats()
+}
+
+// SendAttributes 发送设备属性，用于额定参数、型号等不常变化的数据
+func (p *PlatformClient) SendAttributes(deviceID string, values map[string]interface{}) error {
+	if err := p.publishValues("devices/attributes/"+newMessageID(), deviceID, values, time.Time{}); err != nil {
+		return err
+	}
+	p.logger.WithFields(logrus.Fields{
+		"device_id": deviceID,
+	}).Debug("属性数据发送成功")
+	return nil
+}
+
+// SendEvent 发送设备事件，values 为 {"method": 事件标识, "params": 事件参数}
+func (p *PlatformClient) SendEvent(deviceID string, method string, params map[string]interface{}) error {
+	values := map[string]interface{}{
+		"method": method,
+		"params": params,
+	}
+	if err := p.publishValues("devices/event/"+newMessageID(), deviceID, values, time.Time{}); err != nil {
+		return err
+	}
+	p.logger.WithFields(logrus.Fields{
+		"device_id": deviceID,
+		"method":    method,
+	}).Debug("事件发送成功")
+	return nil
+}
+
+// publishValues 按平台格式发布数据: values 序列化为 JSON 后 base64 编码。
+// ts 非零时附带采集时间(Unix 毫秒)，用于补发的缓存数据。
+func (p *PlatformClient) publishValues(topic string, deviceID string, values map[string]interface{}, ts time.Time) error {
 	// 1. 先将 values 转换为 JSON
 	valuesJSON, err := json.Marshal(values)
 	if err != nil {
@@ -177,6 +377,9 @@ func (p *PlatformClient) SendTelemetry(deviceID string, values map[string]interf
 		"device_id": deviceID,
 		"values":    valuesBase64, // base64 编码的字符串
 	}
+	if !ts.IsZero() {
+		msg["ts"] = ts.UnixMilli()
+	}
 
 	// 4. 将整个消息转换为 JSON
 	payload, err := json.Marshal(msg)
@@ -185,19 +388,33 @@ func (p *PlatformClient) SendTelemetry(deviceID string, values map[string]interf
 	}
 
 	// 5. 发送消息
-	if err := p.sdkClient.MQTT().Publish("devices/telemetry", 1, string(payload)); err != nil {
+	if err := p.sdkClient.MQTT().Publish(topic, 1, string(payload)); err != nil {
 		return fmt.Errorf("发送消息失败: %v", err)
 	}
 
 	p.logger.WithFields(logrus.Fields{
 		"device_id": deviceID,
-	}).Debug("遥测数据发送成功", string(valuesJSON))
-
+		"topic":     topic,
+	}).Debug("消息发送成功", string(valuesJSON))
 	return nil
 }
 
+// newMessageID 生成消息ID
+func newMessageID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
 // Close 关闭客户端
 func (p *PlatformClient) Close() {
+	close(p.done)
+	if p.commands != nil {
+		p.commands.Disconnect(250)
+	}
+	if p.queue != nil {
+		if err := p.queue.close(); err != nil {
+			p.logger.WithError(err).Error("关闭遥测缓存队列失败")
+		}
+	}
 	if p.sdkClient != nil {
 		p.sdkClient.Close()
 	}
@@ -226,3 +443,97 @@ func (p *PlatformClient) SendHeartbeat(ctx context.Context, serviceIdentifier st
 
 	return nil
 }
+
+// Command 平台下发的设备命令
+type Command struct {
+	DeviceID  string                 `json:"-"`
+	MessageID string                 `json:"-"`
+	Method    string                 `json:"method"`
+	Params    map[string]interface{} `json:"params"`
+}
+
+// CommandHandler 设备命令处理函数
+type CommandHandler func(cmd *Command)
+
+// SubscribeCommands 订阅平台下发给本插件设备的命令，
+// 主题为 plugin/{serviceIdentifier}/devices/command/{device_id}/{message_id}。
+// SDK 的 MQTT 连接使用 CleanSession 且不提供连接建立回调，断线重连后订阅会丢失，
+// 因此命令使用单独的 MQTT 连接，每次(重新)连接成功时重新订阅。
+func (p *PlatformClient) SubscribeCommands(serviceIdentifier string, handler CommandHandler) error {
+	topic := fmt.Sprintf("plugin/%s/devices/command/+/+", serviceIdentifier)
+	onMessage := func(_ mqtt.Client, msg mqtt.Message) {
+		p.handleCommand(msg.Topic(), msg.Payload(), handler)
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(p.config.MQTTBroker).
+		SetClientID(fmt.Sprintf("SANTAK-RTU-CMD-%d", time.Now().Unix())).
+		SetUsername(p.config.MQTTUsername).
+		SetPassword(p.config.MQTTPassword).
+		SetAutoReconnect(true).
+		SetCleanSession(true).
+		SetKeepAlive(30 * time.Second).
+		SetConnectTimeout(30 * time.Second).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			p.logger.WithError(err).Warn("命令订阅连接断开，等待重连")
+		}).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			// 在独立协程中调用，可以等待订阅结果
+			if token := c.Subscribe(topic, 1, onMessage); token.Wait() && token.Error() != nil {
+				p.logger.WithError(token.Error()).Errorf("订阅设备命令失败: %s", topic)
+				return
+			}
+			p.logger.Infof("已订阅设备命令: %s", topic)
+		})
+
+	c := mqtt.NewClient(opts)
+	if token := c.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("命令订阅连接失败: %v", token.Error())
+	}
+	p.commands = c
+	return nil
+}
+
+// handleCommand 解析命令主题和内容后交给 handler 执行
+func (p *PlatformClient) handleCommand(topic string, payload []byte, handler CommandHandler) {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 2 {
+		p.logger.WithField("topic", topic).Warn("命令主题格式错误")
+		return
+	}
+	cmd := &Command{
+		DeviceID:  parts[len(parts)-2],
+		MessageID: parts[len(parts)-1],
+	}
+	if err := json.Unmarshal(payload, cmd); err != nil {
+		p.logger.WithError(err).WithField("topic", topic).Error("解析设备命令失败")
+		p.SendCommandResponse(cmd, fmt.Errorf("解析命令失败: %v", err))
+		return
+	}
+	p.logger.WithFields(logrus.Fields{
+		"device_id":  cmd.DeviceID,
+		"message_id": cmd.MessageID,
+		"method":     cmd.Method,
+	}).Info("收到设备命令")
+	// 命令需要等待TCP会话执行，不阻塞MQTT回调
+	go handler(cmd)
+}
+
+// SendCommandResponse 回复命令执行结果，err 为 nil 表示成功
+func (p *PlatformClient) SendCommandResponse(cmd *Command, err error) error {
+	rsp := map[string]interface{}{
+		"device_id": cmd.DeviceID,
+		"method":    cmd.Method,
+		"result":    0,
+		"message":   "success",
+		"ts":        time.Now().Unix(),
+	}
+	if err != nil {
+		rsp["result"] = 1
+		rsp["message"] = err.Error()
+	}
+	payload, mErr := json.Marshal(rsp)
+	if mErr != nil {
+		return fmt.Errorf("序列化命令响应失败: %v", mErr)
+	}
+	return p.sdkClient.MQTT().Publish("devices/command/response/"+cmd.MessageID, 1, string(payload))
+}
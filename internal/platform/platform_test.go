@@ -0,0 +1,200 @@
+package platform
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeBroker 最小的 MQTT 3.1.1 服务端，只处理 CONNECT、SUBSCRIBE、PINGREQ、DISCONNECT，
+// 并向已订阅的当前连接下发 QoS 0 消息。与 CleanSession 的服务端一样，新连接不保留之前的订阅。
+type fakeBroker struct {
+	ln         net.Listener
+	subscribed chan string // 收到的订阅主题
+
+	mu    sync.Mutex
+	conn  net.Conn // 最近建立的连接
+	topic string   // 当前连接订阅的主题
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{ln: ln, subscribed: make(chan string, 10)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conn, b.topic = conn, ""
+			b.mu.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var header [1]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return
+		}
+		body, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		switch header[0] >> 4 {
+		case 1: // CONNECT
+			conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 8: // SUBSCRIBE: 报文ID，随后为 主题长度、主题、QoS
+			n := int(body[2])<<8 | int(body[3])
+			topic := string(body[4 : 4+n])
+			b.mu.Lock()
+			if b.conn == conn {
+				b.topic = topic
+			}
+			b.mu.Unlock()
+			conn.Write([]byte{0x90, 0x03, body[0], body[1], 0x00})
+			b.subscribed <- topic
+		case 12: // PINGREQ
+			conn.Write([]byte{0xd0, 0x00})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// readPacket 读取剩余长度及报文内容
+func readPacket(r io.Reader) ([]byte, error) {
+	length, multiplier := 0, 1
+	for {
+		var b [1]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		length += int(b[0]&0x7f) * multiplier
+		if b[0]&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+// waitSubscribe 等待客户端订阅 topic
+func (b *fakeBroker) waitSubscribe(t *testing.T, topic string) {
+	t.Helper()
+	select {
+	case got := <-b.subscribed:
+		if got != topic {
+			t.Fatalf("订阅主题 %q, 期望 %q", got, topic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("等待订阅 %s 超时", topic)
+	}
+}
+
+// publish 向当前连接下发消息，当前连接未订阅时丢弃
+func (b *fakeBroker) publish(t *testing.T, topic, payload string) {
+	t.Helper()
+	b.mu.Lock()
+	conn, subscribed := b.conn, b.topic != ""
+	b.mu.Unlock()
+	if !subscribed {
+		return
+	}
+	body := append([]byte{byte(len(topic) >> 8), byte(len(topic))}, topic...)
+	body = append(body, payload...)
+	packet := []byte{0x30}
+	for n := len(body); ; {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if n == 0 {
+			break
+		}
+	}
+	if _, err := conn.Write(append(packet, body...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// drop 断开当前连接，模拟 MQTT 服务器重启或网络中断
+func (b *fakeBroker) drop() {
+	b.mu.Lock()
+	b.conn.Close()
+	b.mu.Unlock()
+}
+
+// waitCommand 等待命令回调
+func waitCommand(t *testing.T, commands <-chan *Command, messageID string) {
+	t.Helper()
+	select {
+	case cmd := <-commands:
+		if cmd.DeviceID != "dev-1" || cmd.MessageID != messageID || cmd.Method != "test" {
+			t.Errorf("命令 = %+v, 期望 dev-1 %s test", cmd, messageID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("未收到命令 %s", messageID)
+	}
+}
+
+func TestSubscribeCommandsReconnect(t *testing.T) {
+	broker := newFakeBroker(t)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p, err := New(Config{BaseURL: "http://127.0.0.1:1", MQTTBroker: broker.url()}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+
+	commands := make(chan *Command, 1)
+	if err := p.SubscribeCommands("SANTAK-RTU", func(cmd *Command) { commands <- cmd }); err != nil {
+		t.Fatal(err)
+	}
+	const topic = "plugin/SANTAK-RTU/devices/command/+/+"
+	broker.waitSubscribe(t, topic)
+	broker.publish(t, "plugin/SANTAK-RTU/devices/command/dev-1/m1", `{"method":"test"}`)
+	waitCommand(t, commands, "m1")
+
+	// 服务端不保留订阅，重连后必须重新订阅才能继续收到命令
+	broker.drop()
+	broker.waitSubscribe(t, topic)
+	broker.publish(t, "plugin/SANTAK-RTU/devices/command/dev-1/m2", `{"method":"test"}`)
+	waitCommand(t, commands, "m2")
+}
+
+func TestNewWithoutConnect(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p, err := New(Config{BaseURL: "http://127.0.0.1:1", MQTTBroker: "tcp://127.0.0.1:1"}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SendTelemetry("dev-1", map[string]interface{}{"loadpower": 1.8}); err == nil {
+		t.Error("未连接时发布遥测应返回错误")
+	}
+	p.Close()
+}
@@ -0,0 +1,273 @@
+package platform
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize    = 10000 // 未配置队列容量时使用
+	queueFileName       = "telemetry.jsonl"
+	queueAckFileName    = "telemetry.ack" // 已补发的最大序号
+	queueReplayInterval = 5 * time.Second // 检查并补发缓存数据的周期
+	queueReplayBatch    = 100             // 每批补发的条数，批次之间释放锁
+)
+
+// errQueueClosed 队列已关闭
+var errQueueClosed = errors.New("遥测缓存队列已关闭")
+
+// queuedTelemetry 发布失败后暂存的遥测数据，每条占队列文件一行
+type queuedTelemetry struct {
+	Seq      uint64                 `json:"seq"` // 入队序号，重启后继续递增
+	DeviceID string                 `json:"device_id"`
+	Ts       int64                  `json:"ts"` // 采集时间，Unix 毫秒
+	Values   map[string]interface{} `json:"values"`
+}
+
+// QueueStats 遥测缓存队列统计
+type QueueStats struct {
+	Enabled  bool  `json:"enabled"`
+	Depth    int   `json:"depth"`    // 等待补发的条数
+	Capacity int   `json:"capacity"` // 队列容量
+	Dropped  int64 `json:"dropped"`  // 队列满时丢弃的最旧数据累计条数
+	Replayed int64 `json:"replayed"` // 已补发的累计条数
+}
+
+// telemetryQueue 有界的磁盘遥测队列。内存中保存待发送数据的副本，文件只追加；
+// 补发成功后把最大序号写入确认文件，重启时跳过已确认的行。
+// 已发送或被丢弃的行累计超过容量时、以及关闭队列时重写文件。
+type telemetryQueue struct {
+	mu       sync.Mutex
+	path     string
+	ackPath  string
+	max      int
+	entries  []queuedTelemetry
+	file     *os.File
+	stale    int    // 文件中位于 entries 之前、已失效的行数
+	seq      uint64 // 最近入队的序号
+	dropped  int64
+	replayed int64
+}
+
+// openTelemetryQueue 打开 dir 下的队列文件，加载上次未发送的数据
+func openTelemetryQueue(dir string, max int) (*telemetryQueue, error) {
+	if max <= 0 {
+		max = defaultQueueSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建队列目录失败: %v", err)
+	}
+	q := &telemetryQueue{
+		path:    filepath.Join(dir, queueFileName),
+		ackPath: filepath.Join(dir, queueAckFileName),
+		max:     max,
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// load 读取队列文件，跳过已确认和无法解析的行，超出容量时保留最新的数据
+func (q *telemetryQueue) load() error {
+	q.seq = q.loadAck()
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("打开队列文件失败: %v", err)
+	}
+	defer f.Close()
+	committed := q.seq
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e queuedTelemetry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.DeviceID == "" || e.Seq <= committed {
+			continue
+		}
+		if e.Seq > q.seq {
+			q.seq = e.Seq
+		}
+		q.entries = append(q.entries, e)
+	}
+	if over := len(q.entries) - q.max; over > 0 {
+		q.entries = q.entries[over:]
+		q.dropped += int64(over)
+	}
+	return scanner.Err()
+}
+
+// loadAck 读取已确认的最大序号，文件不存在或损坏时返回0，即补发文件中的全部数据
+func (q *telemetryQueue) loadAck() uint64 {
+	data, err := os.ReadFile(q.ackPath)
+	if err != nil {
+		return 0
+	}
+	seq, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
+// saveAck 写入已确认的最大序号，先写临时文件再替换，避免写入中断留下损坏的文件
+func (q *telemetryQueue) saveAck(seq uint64) error {
+	tmp := q.ackPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(seq, 10)), 0644); err != nil {
+		return fmt.Errorf("写入队列确认文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, q.ackPath); err != nil {
+		return fmt.Errorf("替换队列确认文件失败: %v", err)
+	}
+	return nil
+}
+
+// push 追加一条数据，队列已满时丢弃最旧的一条
+func (q *telemetryQueue) push(e queuedTelemetry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return errQueueClosed
+	}
+	e.Seq = q.seq + 1
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("序列化缓存数据失败: %v", err)
+	}
+	if len(q.entries) >= q.max {
+		q.entries = q.entries[1:]
+		q.stale++
+		q.dropped++
+	}
+	q.seq = e.Seq
+	q.entries = append(q.entries, e)
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入队列文件失败: %v", err)
+	}
+	if q.stale > q.max {
+		return q.compact()
+	}
+	return nil
+}
+
+// peek 返回最早的至多 n 条数据
+func (q *telemetryQueue) peek(n int) []queuedTelemetry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > len(q.entries) {
+		n = len(q.entries)
+	}
+	return append([]queuedTelemetry(nil), q.entries[:n]...)
+}
+
+// ack 移除序号不大于 seq 的数据，即已补发的数据及补发期间因队列满被丢弃的数据，
+// 并记录到确认文件，重启后不再补发
+func (q *telemetryQueue) ack(seq uint64, n int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return errQueueClosed
+	}
+	q.replayed += int64(n)
+	i := 0
+	for i < len(q.entries) && q.entries[i].Seq <= seq {
+		i++
+	}
+	q.entries = q.entries[i:]
+	q.stale += i
+	if err := q.saveAck(seq); err != nil {
+		return err
+	}
+	if len(q.entries) == 0 || q.stale > q.max {
+		return q.compact()
+	}
+	return nil
+}
+
+// len 返回等待补发的条数
+func (q *telemetryQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// stats 返回队列统计
+func (q *telemetryQueue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{
+		Enabled:  true,
+		Depth:    len(q.entries),
+		Capacity: q.max,
+		Dropped:  q.dropped,
+		Replayed: q.replayed,
+	}
+}
+
+// compact 用待发送数据重写队列文件，调用方持有锁或独占队列
+func (q *telemetryQueue) compact() error {
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("创建队列文件失败: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range q.entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("写入队列文件失败: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("写入队列文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("替换队列文件失败: %v", err)
+	}
+	q.stale = 0
+	q.file, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开队列文件失败: %v", err)
+	}
+	return nil
+}
+
+// close 用未发送的数据重写队列文件后关闭，未发送的数据保留到下次启动
+func (q *telemetryQueue) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	err := q.compact()
+	if q.file != nil {
+		if closeErr := q.file.Close(); err == nil {
+			err = closeErr
+		}
+		q.file = nil
+	}
+	return err
+}
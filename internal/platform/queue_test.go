@@ -0,0 +1,182 @@
+package platform
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openTestQueue(t *testing.T, dir string, max int) *telemetryQueue {
+	t.Helper()
+	q, err := openTelemetryQueue(dir, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func pushDevices(t *testing.T, q *telemetryQueue, devices ...string) {
+	t.Helper()
+	for _, dev := range devices {
+		if err := q.push(queuedTelemetry{DeviceID: dev, Ts: 1, Values: map[string]interface{}{"loadpower": 1.8}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// queued 返回队列中的 设备ID:序号
+func queued(q *telemetryQueue) map[string]uint64 {
+	got := map[string]uint64{}
+	for _, e := range q.peek(q.len()) {
+		got[e.DeviceID] = e.Seq
+	}
+	return got
+}
+
+// crash 只关闭文件句柄，模拟进程异常退出，不重写队列文件
+func crash(q *telemetryQueue) {
+	q.file.Close()
+	q.file = nil
+}
+
+// fileLines 返回队列文件的行数
+func fileLines(t *testing.T, dir string) int {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, queueFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestTelemetryQueuePushPeekAck(t *testing.T) {
+	q := openTestQueue(t, t.TempDir(), 10)
+	defer q.close()
+	pushDevices(t, q, "a", "b", "c")
+
+	batch := q.peek(2)
+	if len(batch) != 2 || batch[0].DeviceID != "a" || batch[0].Seq != 1 || batch[1].DeviceID != "b" || batch[1].Seq != 2 {
+		t.Fatalf("peek(2) = %+v, 期望 a:1 b:2", batch)
+	}
+	if err := q.ack(batch[1].Seq, len(batch)); err != nil {
+		t.Fatal(err)
+	}
+	if got := queued(q); !reflect.DeepEqual(got, map[string]uint64{"c": 3}) {
+		t.Errorf("ack 后队列 = %v, 期望 c:3", got)
+	}
+	if st := q.stats(); !st.Enabled || st.Depth != 1 || st.Capacity != 10 || st.Replayed != 2 || st.Dropped != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+	if got := q.peek(10); len(got) != 1 {
+		t.Errorf("peek(10) = %d 条, 期望 1", len(got))
+	}
+}
+
+// TestTelemetryQueueReopenAfterAck 异常退出后重启，已补发的数据不再补发，序号继续递增
+func TestTelemetryQueueReopenAfterAck(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestQueue(t, dir, 10)
+	pushDevices(t, q, "a", "b", "c")
+	if err := q.ack(2, 2); err != nil {
+		t.Fatal(err)
+	}
+	crash(q)
+
+	q = openTestQueue(t, dir, 10)
+	defer q.close()
+	if got := queued(q); !reflect.DeepEqual(got, map[string]uint64{"c": 3}) {
+		t.Errorf("重启后队列 = %v, 期望只有未补发的 c:3", got)
+	}
+	pushDevices(t, q, "d")
+	if got := queued(q); !reflect.DeepEqual(got, map[string]uint64{"c": 3, "d": 4}) {
+		t.Errorf("重启后入队 = %v, 期望 d 的序号为 4", got)
+	}
+}
+
+// TestTelemetryQueueCloseCompacts 正常关闭时队列文件只保留未补发的数据
+func TestTelemetryQueueCloseCompacts(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestQueue(t, dir, 10)
+	pushDevices(t, q, "a", "b", "c")
+	if err := q.ack(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := fileLines(t, dir); n != 2 {
+		t.Errorf("关闭后队列文件 %d 行, 期望 2", n)
+	}
+	if err := q.push(queuedTelemetry{DeviceID: "d"}); !errors.Is(err, errQueueClosed) {
+		t.Errorf("关闭后 push err = %v, 期望 errQueueClosed", err)
+	}
+
+	// 确认文件丢失时也不会补发已确认的数据
+	if err := os.Remove(filepath.Join(dir, queueAckFileName)); err != nil {
+		t.Fatal(err)
+	}
+	q = openTestQueue(t, dir, 10)
+	defer q.close()
+	if got := queued(q); !reflect.DeepEqual(got, map[string]uint64{"b": 2, "c": 3}) {
+		t.Errorf("重启后队列 = %v, 期望 b:2 c:3", got)
+	}
+}
+
+func TestTelemetryQueueOverflow(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestQueue(t, dir, 3)
+	pushDevices(t, q, "a", "b", "c", "d", "e")
+	if got := queued(q); !reflect.DeepEqual(got, map[string]uint64{"c": 3, "d": 4, "e": 5}) {
+		t.Errorf("队列 = %v, 期望保留最新的 c d e", got)
+	}
+	if st := q.stats(); st.Depth != 3 || st.Dropped != 2 {
+		t.Errorf("stats = %+v, 期望 depth 3 dropped 2", st)
+	}
+	crash(q)
+
+	// 异常退出后队列文件中仍有被丢弃的行，重启时按容量只保留最新的数据
+	q = openTestQueue(t, dir, 3)
+	if got := queued(q); !reflect.DeepEqual(got, map[string]uint64{"c": 3, "d": 4, "e": 5}) {
+		t.Errorf("重启后队列 = %v, 期望 c d e", got)
+	}
+	if err := q.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启时容量变小，只保留最新的数据
+	q = openTestQueue(t, dir, 2)
+	defer q.close()
+	if got := queued(q); !reflect.DeepEqual(got, map[string]uint64{"d": 4, "e": 5}) {
+		t.Errorf("重启后队列 = %v, 期望 d e", got)
+	}
+	if st := q.stats(); st.Dropped != 1 {
+		t.Errorf("重启后 dropped = %d, 期望 1", st.Dropped)
+	}
+}
+
+func TestTelemetryQueueCorruptLines(t *testing.T) {
+	dir := t.TempDir()
+	content := "{not json\n" +
+		`{"seq":1,"device_id":"a","ts":1,"values":{}}` + "\n" +
+		`{"seq":2,"ts":1,"values":{}}` + "\n" +
+		`{"seq":3,"device_id":"c","ts":1,"values":{}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, queueFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, queueAckFileName), []byte("bad"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q := openTestQueue(t, dir, 10)
+	defer q.close()
+	if got := queued(q); !reflect.DeepEqual(got, map[string]uint64{"a": 1, "c": 3}) {
+		t.Errorf("队列 = %v, 期望跳过无法解析的行", got)
+	}
+}
@@ -0,0 +1,186 @@
+// Package profile 加载机型配置文件，按配置将应答字段映射为遥测数据，
+// 用于字段顺序与内置 CKS 映射不同的固件。
+package profile
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"tp-santak-rtu/internal/protocol"
+
+	"github.com/spf13/viper"
+)
+
+// 字段类型
+const (
+	TypeFloat  = "float"  // 数值，乘以 scale
+	TypeInt    = "int"    // 数值，乘以 scale 后取整
+	TypeString = "string" // 原样上报
+	TypeBits   = "bits"   // 状态位，逐位映射到 keys
+)
+
+// DefaultName 内置 CKS 映射的机型名，设备未选择机型时使用
+const DefaultName = "cks"
+
+// defaultDecimals float 字段默认保留的小数位数，与内置映射相同
+const defaultDecimals = 1
+
+// Profile 一个机型的字段映射
+type Profile struct {
+	Name        string           `yaml:"name"`
+	Description string           `yaml:"description"`
+	Commands    []CommandProfile `yaml:"commands"`
+}
+
+// CommandProfile 单条指令应答的字段映射
+type CommandProfile struct {
+	Command  string         `yaml:"command"`  // 指令，如 WA、Q6、Q1
+	Fields   int            `yaml:"fields"`   // 应答字段数量
+	Mappings []FieldMapping `yaml:"mappings"` // 字段映射
+}
+
+// FieldMapping 应答字段到遥测键的映射
+type FieldMapping struct {
+	Index      int      `yaml:"index"`      // 字段序号，从0开始
+	Key        string   `yaml:"key"`        // 遥测键名，bits 类型不使用
+	Type       string   `yaml:"type"`       // float、int、string、bits，默认 float
+	Scale      float64  `yaml:"scale"`      // 数值系数，默认 1
+	Decimals   int      `yaml:"decimals"`   // float 类型保留的小数位数，默认 1，与内置映射一致
+	Unit       string   `yaml:"unit"`       // 单位，仅用于说明
+	ThreePhase bool     `yaml:"threePhase"` // 只有三相设备才上报，如 L2/L3 字段
+	Keys       []string `yaml:"keys"`       // bits 类型每一位对应的键名，空字符串跳过该位
+}
+
+// Load 读取机型配置文件，返回按名称索引的机型
+func Load(path string) (map[string]*Profile, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Profiles []Profile `yaml:"profiles"`
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]*Profile, len(file.Profiles))
+	for i := range file.Profiles {
+		p := &file.Profiles[i]
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("机型 %s 配置错误: %v", p.Name, err)
+		}
+		if _, ok := profiles[p.Name]; ok {
+			return nil, fmt.Errorf("机型 %s 重复定义", p.Name)
+		}
+		profiles[p.Name] = p
+	}
+	return profiles, nil
+}
+
+// validate 校验配置并补齐默认值
+func (p *Profile) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("缺少机型名")
+	}
+	for ci := range p.Commands {
+		c := &p.Commands[ci]
+		if c.Command == "" || c.Fields <= 0 {
+			return fmt.Errorf("指令 %q 缺少指令名或字段数量", c.Command)
+		}
+		for mi := range c.Mappings {
+			m := &c.Mappings[mi]
+			if m.Index < 0 || m.Index >= c.Fields {
+				return fmt.Errorf("指令 %s 字段序号 %d 超出范围", c.Command, m.Index)
+			}
+			if m.Type == "" {
+				m.Type = TypeFloat
+			}
+			if m.Scale == 0 {
+				m.Scale = 1
+			}
+			if m.Decimals < 0 {
+				return fmt.Errorf("指令 %s 字段 %d 小数位数 %d 无效", c.Command, m.Index, m.Decimals)
+			}
+			if m.Decimals == 0 {
+				m.Decimals = defaultDecimals
+			}
+			switch m.Type {
+			case TypeFloat, TypeInt, TypeString:
+				if m.Key == "" {
+					return fmt.Errorf("指令 %s 字段 %d 缺少键名", c.Command, m.Index)
+				}
+			case TypeBits:
+				if len(m.Keys) == 0 {
+					return fmt.Errorf("指令 %s 字段 %d 缺少状态位键名", c.Command, m.Index)
+				}
+			default:
+				return fmt.Errorf("指令 %s 字段 %d 类型 %q 不支持", c.Command, m.Index, m.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// Command 返回指令的字段映射，机型未定义该指令时返回 nil
+func (p *Profile) Command(cmd string) *CommandProfile {
+	for i := range p.Commands {
+		if p.Commands[i].Command == cmd {
+			return &p.Commands[i]
+		}
+	}
+	return nil
+}
+
+// Decode 按映射解析应答帧。phases 为 1 时跳过三相字段；占位符字段不上报。
+func (c *CommandProfile) Decode(frame string, phases int) (map[string]interface{}, error) {
+	fields, err := protocol.Fields(frame)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != c.Fields {
+		return nil, fmt.Errorf("%w: %s 需要 %d 个字段，收到 %d 个", protocol.ErrFieldCount, c.Command, c.Fields, len(fields))
+	}
+
+	data := make(map[string]interface{}, len(c.Mappings))
+	for _, m := range c.Mappings {
+		if m.ThreePhase && phases == 1 {
+			continue
+		}
+		raw := fields[m.Index]
+		if m.Type != TypeBits && protocol.IsPlaceholder(raw) {
+			continue
+		}
+		switch m.Type {
+		case TypeString:
+			data[m.Key] = raw
+		case TypeBits:
+			for i, key := range m.Keys {
+				if key == "" {
+					continue
+				}
+				if i >= len(raw) || (raw[i] != '0' && raw[i] != '1') {
+					return nil, fmt.Errorf("%w: %s 状态位 %q", protocol.ErrInvalidValue, c.Command, raw)
+				}
+				data[key] = int(raw[i] - '0')
+			}
+		default:
+			// 与内置映射相同按单精度解析，保证同一应答两种方式上报的数值一致
+			v, err := strconv.ParseFloat(raw, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s 字段 %d %q", protocol.ErrInvalidValue, c.Command, m.Index, raw)
+			}
+			v *= m.Scale
+			if m.Type == TypeInt {
+				data[m.Key] = int(math.Round(v))
+			} else {
+				scale := math.Pow10(m.Decimals)
+				data[m.Key] = math.Round(v*scale) / scale
+			}
+		}
+	}
+	return data, nil
+}
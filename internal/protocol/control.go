@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+)
+
+// 控制指令，UPS 正常执行时无应答，不支持时应答 "(NAK"
+const (
+	CmdTest           = "T"  // 电池自检 10 秒
+	CmdTestUntilLow   = "TL" // 电池自检直到电池电压低
+	CmdCancelTest     = "CT" // 取消自检
+	CmdCancelShutdown = "C"  // 取消关机
+	CmdToggleBeeper   = "Q"  // 切换蜂鸣器开关
+)
+
+// EncodeTestMinutes 编码定时自检指令 "T<n>"，n 为 1~99 分钟
+func EncodeTestMinutes(minutes int) (string, error) {
+	if minutes < 1 || minutes > 99 {
+		return "", fmt.Errorf("%w: 自检时间 %d 分钟，取值范围 1~99", ErrInvalidValue, minutes)
+	}
+	return fmt.Sprintf("T%02d", minutes), nil
+}
+
+// EncodeShutdown 编码延时关机并恢复指令 "S<n>R<m>"。
+// delay 为关机延时(分钟)，小于 1 分钟时取 0.2~0.9，否则取 1~10 的整数；
+// restore 为关机后恢复供电的等待时间(分钟)，取值 0~9999，0 表示不自动恢复。
+func EncodeShutdown(delay float64, restore int) (string, error) {
+	var n string
+	tenths := int(math.Round(delay * 10))
+	switch {
+	case tenths >= 2 && tenths <= 9:
+		n = fmt.Sprintf(".%d", tenths)
+	case tenths >= 10 && tenths <= 100 && tenths%10 == 0:
+		n = fmt.Sprintf("%02d", tenths/10)
+	default:
+		return "", fmt.Errorf("%w: 关机延时 %v 分钟，取值范围 0.2~0.9 或 1~10", ErrInvalidValue, delay)
+	}
+	if restore < 0 || restore > 9999 {
+		return "", fmt.Errorf("%w: 恢复时间 %d 分钟，取值范围 0~9999", ErrInvalidValue, restore)
+	}
+	return fmt.Sprintf("S%sR%04d", n, restore), nil
+}
@@ -0,0 +1,137 @@
+// Package protocol 实现山特(Santak) UPS RS232 文本协议的编解码，
+// 不依赖平台和网络，可供其他工具复用。
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 轮询指令
+const (
+	CmdWA = "WA" // 负载功率及状态
+	CmdQ6 = "Q6" // 输入输出电压、频率及电池信息
+	CmdQ1 = "Q1" // Megatec 状态查询
+)
+
+// Terminator 指令及应答结束符
+const Terminator = "\r"
+
+var (
+	// ErrNAK UPS 不支持该指令，应答 "(NAK"
+	ErrNAK = errors.New("UPS 应答 NAK")
+	// ErrFieldCount 应答字段数量与指令不符
+	ErrFieldCount = errors.New("应答字段数量不对")
+	// ErrInvalidValue 应答字段无法解析
+	ErrInvalidValue = errors.New("应答字段格式错误")
+)
+
+// Encode 编码下发给 UPS 的指令，追加结束符
+func Encode(cmd string) []byte {
+	return []byte(strings.TrimSpace(cmd) + Terminator)
+}
+
+// Fields 将一帧应答切分为字段，去掉起始符 "(" 或 "#" 和结束符
+func Fields(frame string) ([]string, error) {
+	frame = strings.TrimSuffix(frame, Terminator)
+	if frame == "(NAK" {
+		return nil, ErrNAK
+	}
+	frame = strings.TrimPrefix(frame, "(")
+	frame = strings.TrimPrefix(frame, "#")
+	return strings.Fields(frame), nil
+}
+
+// fieldsN 切分应答并校验字段数量
+func fieldsN(cmd, frame string, n int) ([]string, error) {
+	fields, err := Fields(frame)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != n {
+		return nil, fmt.Errorf("%w: %s 需要 %d 个字段，收到 %d 个", ErrFieldCount, cmd, n, len(fields))
+	}
+	return fields, nil
+}
+
+// parseFloat 解析数值字段，保留一位小数
+func parseFloat(field string) (float64, error) {
+	return parseFloatPrec(field, 1)
+}
+
+// parseFloatPrec 解析数值字段，保留 prec 位小数
+func parseFloatPrec(field string, prec int) (float64, error) {
+	v, err := strconv.ParseFloat(field, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidValue, field)
+	}
+	scale := math.Pow10(prec)
+	return math.Round(v*scale) / scale, nil
+}
+
+// Value 可能不被机型支持的数值字段，不支持时 UPS 以 "---.-" 等占位符填充
+type Value struct {
+	Float float64
+	Valid bool // false 表示占位符
+}
+
+// IsPlaceholder 判断字段是否为占位符，只由 '-'、'_'、'.' 组成
+func IsPlaceholder(field string) bool {
+	return field != "" && strings.Trim(field, "-_.") == "" && strings.Trim(field, ".") != ""
+}
+
+// parseValue 解析可能为占位符的数值字段，保留一位小数
+func parseValue(field string) (Value, error) {
+	if IsPlaceholder(field) {
+		return Value{}, nil
+	}
+	v, err := parseFloat(field)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Float: v, Valid: true}, nil
+}
+
+func errStatusBits(field string) error {
+	return fmt.Errorf("%w: 状态位 %q", ErrInvalidValue, field)
+}
+
+// StatusBits UPS 状态位，顺序与 Megatec 协议一致
+type StatusBits struct {
+	UtilityFail    bool // 市电异常
+	BatteryLow     bool // 电池电压低
+	Bypass         bool // 旁路/升压工作
+	UPSFailed      bool // UPS 故障
+	Standby        bool // 后备式 UPS
+	TestInProgress bool // 自检中
+	ShutdownActive bool // 关机中
+}
+
+// ParseStatusBits 解析 "b7b6b5b4b3b2b1b0" 形式的状态位字段，只使用前 7 位
+func ParseStatusBits(field string) (StatusBits, error) {
+	if len(field) < 7 {
+		return StatusBits{}, errStatusBits(field)
+	}
+	bits := make([]bool, 7)
+	for i := range bits {
+		switch field[i] {
+		case '0':
+		case '1':
+			bits[i] = true
+		default:
+			return StatusBits{}, errStatusBits(field)
+		}
+	}
+	return StatusBits{
+		UtilityFail:    bits[0],
+		BatteryLow:     bits[1],
+		Bypass:         bits[2],
+		UPSFailed:      bits[3],
+		Standby:        bits[4],
+		TestInProgress: bits[5],
+		ShutdownActive: bits[6],
+	}, nil
+}
@@ -0,0 +1,332 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// 现场 DTU 转发的应答帧，单相机型不支持的字段为占位符
+const (
+	frameWA1P = "(001.8 ---.- ---.- 002.1 ---.- ---.- 001.8 002.1 009.2 ---.- ---.- 035 10000000"
+	frameWA3P = "(003.1 002.9 003.4 003.6 003.3 003.9 009.4 010.8 014.2 013.6 015.1 042 00000100"
+	frameQ61P = "(229.8 ---.- ---.- 50.0 220.1 ---.- ---.- 50.0 229.8 ---.- ---.- 081.6 ---.- 50.0 0045 100 025.0 031.0 -- --"
+	frameQ63P = "(229.8 230.4 228.9 50.0 220.1 220.0 219.8 50.0 229.8 230.4 228.9 272.4 272.1 50.0 0120 095 026.5 033.0 00 02"
+	frameQ1   = "(208.4 140.0 208.4 034 59.9 2.05 35.0 00110001"
+)
+
+func v(f float64) Value { return Value{Float: f, Valid: true} }
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{CmdWA, "WA\r"},
+		{CmdQ6, "Q6\r"},
+		{CmdQ1, "Q1\r"},
+		{" Q6 ", "Q6\r"},
+	}
+	for _, tt := range tests {
+		if got := string(Encode(tt.cmd)); got != tt.want {
+			t.Errorf("Encode(%q) = %q, 期望 %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestParseStatusBits(t *testing.T) {
+	tests := []struct {
+		field   string
+		want    StatusBits
+		wantErr bool
+	}{
+		{"00000000", StatusBits{}, false},
+		{"10000000", StatusBits{UtilityFail: true}, false},
+		{"01000010", StatusBits{BatteryLow: true, ShutdownActive: true}, false},
+		{"0011110", StatusBits{Bypass: true, UPSFailed: true, Standby: true, TestInProgress: true}, false},
+		{"001100", StatusBits{}, true},
+		{"0020000", StatusBits{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseStatusBits(tt.field)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseStatusBits(%q) = %+v, %v, 期望 %+v", tt.field, got, err, tt.want)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("ParseStatusBits(%q) 错误类型 %v", tt.field, err)
+		}
+	}
+}
+
+func TestIsPlaceholder(t *testing.T) {
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"---.-", true},
+		{"--", true},
+		{"__._", true},
+		{"000.0", false},
+		{".", false},
+		{"", false},
+		{"-1.5", false},
+	}
+	for _, tt := range tests {
+		if got := IsPlaceholder(tt.field); got != tt.want {
+			t.Errorf("IsPlaceholder(%q) = %v, 期望 %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestParseWA(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		want    *WAReading
+		wantErr error
+	}{
+		{
+			name:  "单相",
+			frame: frameWA1P,
+			want: &WAReading{
+				LoadPower:              [3]Value{v(1.8)},
+				LoadApparentPower:      [3]Value{v(2.1)},
+				LoadPowerTotal:         v(1.8),
+				LoadApparentPowerTotal: v(2.1),
+				OutputCurrent:          [3]Value{v(9.2)},
+				LoadPercentage:         v(35),
+				Status:                 StatusBits{UtilityFail: true},
+			},
+		},
+		{
+			name:  "三相",
+			frame: frameWA3P + "\r",
+			want: &WAReading{
+				LoadPower:              [3]Value{v(3.1), v(2.9), v(3.4)},
+				LoadApparentPower:      [3]Value{v(3.6), v(3.3), v(3.9)},
+				LoadPowerTotal:         v(9.4),
+				LoadApparentPowerTotal: v(10.8),
+				OutputCurrent:          [3]Value{v(14.2), v(13.6), v(15.1)},
+				LoadPercentage:         v(42),
+				Status:                 StatusBits{TestInProgress: true},
+			},
+		},
+		{name: "NAK", frame: "(NAK", wantErr: ErrNAK},
+		{name: "字段缺失", frame: "(001.8 ---.- ---.- 002.1 035 10000000", wantErr: ErrFieldCount},
+		{name: "Q6 应答", frame: frameQ63P, wantErr: ErrFieldCount},
+		{name: "数值错误", frame: "(001.8 ---.- ---.- 002.1 ---.- ---.- 001.8 002.1 009.2 ---.- ---.- 0x5 10000000", wantErr: ErrInvalidValue},
+		{name: "状态位错误", frame: "(001.8 ---.- ---.- 002.1 ---.- ---.- 001.8 002.1 009.2 ---.- ---.- 035 1002", wantErr: ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWA(tt.frame)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, 期望 %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseWA = %+v, 期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQ6(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		want    *Q6Reading
+		wantErr error
+	}{
+		{
+			name:  "单相",
+			frame: frameQ61P,
+			want: &Q6Reading{
+				InputVoltage:       [3]Value{v(229.8)},
+				InputFrequency:     v(50),
+				OutputVoltage:      [3]Value{v(220.1)},
+				OutputFrequency:    v(50),
+				BypassVoltage:      [3]Value{v(229.8)},
+				BatteryVoltage:     v(81.6),
+				BypassFrequency:    v(50),
+				BatteryRemainTime:  v(45),
+				BatteryLevel:       v(100),
+				BatteryTemperature: v(25),
+				Temperature:        v(31),
+			},
+		},
+		{
+			name:  "三相",
+			frame: frameQ63P,
+			want: &Q6Reading{
+				InputVoltage:           [3]Value{v(229.8), v(230.4), v(228.9)},
+				InputFrequency:         v(50),
+				OutputVoltage:          [3]Value{v(220.1), v(220), v(219.8)},
+				OutputFrequency:        v(50),
+				BypassVoltage:          [3]Value{v(229.8), v(230.4), v(228.9)},
+				BatteryVoltage:         v(272.4),
+				BatteryVoltageNegative: v(272.1),
+				BypassFrequency:        v(50),
+				BatteryRemainTime:      v(120),
+				BatteryLevel:           v(95),
+				BatteryTemperature:     v(26.5),
+				Temperature:            v(33),
+				FaultCode:              "00",
+				WarningCode:            "02",
+			},
+		},
+		{name: "NAK", frame: "(NAK\r", wantErr: ErrNAK},
+		{name: "WA 应答", frame: frameWA1P, wantErr: ErrFieldCount},
+		{name: "空帧", frame: "(", wantErr: ErrFieldCount},
+		{name: "数值错误", frame: "(229.8 ---.- ---.- 50.0 220.1 ---.- ---.- 50.0 229.8 ---.- ---.- 081.6 ---.- 50.0 0045 1O0 025.0 031.0 -- --", wantErr: ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQ6(tt.frame)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, 期望 %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQ6 = %+v, 期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQ1(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		want    *Q1Reading
+		wantErr error
+	}{
+		{
+			name:  "蜂鸣器开启",
+			frame: frameQ1,
+			want: &Q1Reading{
+				InputVoltage:      208.4,
+				InputFaultVoltage: 140,
+				OutputVoltage:     208.4,
+				LoadPercentage:    34,
+				InputFrequency:    59.9,
+				BatteryVoltage:    2.05,
+				Temperature:       35,
+				Status:            StatusBits{Bypass: true, UPSFailed: true},
+				BeeperOn:          true,
+			},
+		},
+		{name: "NAK", frame: "(NAK", wantErr: ErrNAK},
+		{name: "字段缺失", frame: "(208.4 140.0 208.4 034 59.9 2.05 35.0", wantErr: ErrFieldCount},
+		{name: "状态位不足 8 位", frame: "(208.4 140.0 208.4 034 59.9 2.05 35.0 0011000", wantErr: ErrInvalidValue},
+		{name: "占位符", frame: "(208.4 140.0 208.4 034 59.9 -.-- 35.0 00110001", wantErr: ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQ1(tt.frame)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, 期望 %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQ1 = %+v, 期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRating(t *testing.T) {
+	got, err := ParseRating("#220.0 000 024.0 50.0\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &RatingInfo{Voltage: 220, Current: 0, BatteryVoltage: 24, Frequency: 50}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRating = %+v, 期望 %+v", got, want)
+	}
+	if _, err := ParseRating("(NAK"); !errors.Is(err, ErrNAK) {
+		t.Errorf("NAK: err = %v", err)
+	}
+	if _, err := ParseRating("#220.0 000 024.0"); !errors.Is(err, ErrFieldCount) {
+		t.Errorf("字段缺失: err = %v", err)
+	}
+}
+
+func TestParseUPSInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		want    *UPSInfo
+		wantErr error
+	}{
+		{
+			name:  "固定宽度",
+			frame: "#SANTAK          C6KS RM    V2.3.1    \r",
+			want:  &UPSInfo{Company: "SANTAK", Model: "C6KS RM", Version: "V2.3.1"},
+		},
+		{
+			name:  "按空白切分",
+			frame: "#SANTAK C3K V1.0",
+			want:  &UPSInfo{Company: "SANTAK", Model: "C3K", Version: "V1.0"},
+		},
+		{name: "NAK", frame: "(NAK", wantErr: ErrNAK},
+		{name: "缺少起始符", frame: "SANTAK C3K V1.0", wantErr: ErrInvalidValue},
+		{name: "字段缺失", frame: "#SANTAK C3K", wantErr: ErrFieldCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseUPSInfo(tt.frame)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, 期望 %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseUPSInfo = %+v, 期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeTestMinutes(t *testing.T) {
+	tests := []struct {
+		minutes int
+		want    string
+		wantErr bool
+	}{
+		{1, "T01", false},
+		{10, "T10", false},
+		{99, "T99", false},
+		{0, "", true},
+		{100, "", true},
+	}
+	for _, tt := range tests {
+		got, err := EncodeTestMinutes(tt.minutes)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("EncodeTestMinutes(%d) = %q, %v, 期望 %q", tt.minutes, got, err, tt.want)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("EncodeTestMinutes(%d) 错误类型 %v", tt.minutes, err)
+		}
+	}
+}
+
+func TestEncodeShutdown(t *testing.T) {
+	tests := []struct {
+		delay   float64
+		restore int
+		want    string
+		wantErr bool
+	}{
+		{0.2, 0, "S.2R0000", false},
+		{0.9, 1, "S.9R0001", false},
+		{1, 30, "S01R0030", false},
+		{10, 9999, "S10R9999", false},
+		{0.1, 0, "", true},
+		{1.5, 0, "", true},
+		{11, 0, "", true},
+		{1, -1, "", true},
+		{1, 10000, "", true},
+	}
+	for _, tt := range tests {
+		got, err := EncodeShutdown(tt.delay, tt.restore)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("EncodeShutdown(%v, %d) = %q, %v, 期望 %q", tt.delay, tt.restore, got, err, tt.want)
+		}
+	}
+}
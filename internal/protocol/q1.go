@@ -0,0 +1,57 @@
+package protocol
+
+// q1FieldCount Q1 应答字段数量
+const q1FieldCount = 8
+
+// Q1Reading Megatec Q1 指令应答
+// "(MMM.M NNN.N PPP.P QQQ RR.R S.SS TT.T b7b6b5b4b3b2b1b0"
+type Q1Reading struct {
+	InputVoltage      float64 // 输入电压 V
+	InputFaultVoltage float64 // 输入故障电压 V
+	OutputVoltage     float64 // 输出电压 V
+	LoadPercentage    float64 // 负载百分比 %
+	InputFrequency    float64 // 输入频率 Hz
+	BatteryVoltage    float64 // 电池电压 V，部分机型为单节电压
+	Temperature       float64 // UPS 温度 ℃
+	Status            StatusBits
+	BeeperOn          bool // 蜂鸣器开启
+}
+
+// ParseQ1 解析 Q1 应答帧
+func ParseQ1(frame string) (*Q1Reading, error) {
+	fields, err := fieldsN(CmdQ1, frame, q1FieldCount)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Q1Reading
+	for _, f := range []struct {
+		index int
+		dst   *float64
+	}{
+		{0, &r.InputVoltage},
+		{1, &r.InputFaultVoltage},
+		{2, &r.OutputVoltage},
+		{3, &r.LoadPercentage},
+		{4, &r.InputFrequency},
+		{6, &r.Temperature},
+	} {
+		if *f.dst, err = parseFloat(fields[f.index]); err != nil {
+			return nil, err
+		}
+	}
+	// S.SS 保留两位小数
+	if r.BatteryVoltage, err = parseFloatPrec(fields[5], 2); err != nil {
+		return nil, err
+	}
+
+	bits := fields[7]
+	if len(bits) != 8 || (bits[7] != '0' && bits[7] != '1') {
+		return nil, errStatusBits(bits)
+	}
+	if r.Status, err = ParseStatusBits(bits); err != nil {
+		return nil, err
+	}
+	r.BeeperOn = bits[7] == '1'
+	return &r, nil
+}
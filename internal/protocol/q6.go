@@ -0,0 +1,68 @@
+package protocol
+
+// q6FieldCount Q6 应答字段数量
+const q6FieldCount = 20
+
+// Q6Reading Q6 指令应答
+// "(MMM.M NNN.N PPP.P RR.R SSS.S TTT.T UUU.U WW.W XXX.X YYY.Y ZZZ.Z +BBB.B -BBB.B KK.K NNNN CCC TT.T UU.U FF WW"
+// 单相机型不支持的 L2/L3 及负电池组字段以占位符表示，对应 Value.Valid 为 false。
+type Q6Reading struct {
+	InputVoltage           [3]Value // L1~L3 输入电压 V
+	InputFrequency         Value    // 输入频率 Hz
+	OutputVoltage          [3]Value // L1~L3 输出电压 V
+	OutputFrequency        Value    // 输出频率 Hz
+	BypassVoltage          [3]Value // L1~L3 旁路电压 V
+	BatteryVoltage         Value    // 正电池组电压 V
+	BatteryVoltageNegative Value    // 负电池组电压 V
+	BypassFrequency        Value    // 旁路频率 Hz
+	BatteryRemainTime      Value    // 电池剩余时间 min
+	BatteryLevel           Value    // 电池电量 %
+	BatteryTemperature     Value    // 电池温度 ℃
+	Temperature            Value    // UPS 温度 ℃
+	FaultCode              string   // 故障码，占位符时为空
+	WarningCode            string   // 告警码，占位符时为空
+}
+
+// ParseQ6 解析 Q6 应答帧
+func ParseQ6(frame string) (*Q6Reading, error) {
+	fields, err := fieldsN(CmdQ6, frame, q6FieldCount)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Q6Reading
+	for _, f := range []struct {
+		index int
+		dst   *Value
+	}{
+		{0, &r.InputVoltage[0]},
+		{1, &r.InputVoltage[1]},
+		{2, &r.InputVoltage[2]},
+		{3, &r.InputFrequency},
+		{4, &r.OutputVoltage[0]},
+		{5, &r.OutputVoltage[1]},
+		{6, &r.OutputVoltage[2]},
+		{7, &r.OutputFrequency},
+		{8, &r.BypassVoltage[0]},
+		{9, &r.BypassVoltage[1]},
+		{10, &r.BypassVoltage[2]},
+		{11, &r.BatteryVoltage},
+		{12, &r.BatteryVoltageNegative},
+		{13, &r.BypassFrequency},
+		{14, &r.BatteryRemainTime},
+		{15, &r.BatteryLevel},
+		{16, &r.BatteryTemperature},
+		{17, &r.Temperature},
+	} {
+		if *f.dst, err = parseValue(fields[f.index]); err != nil {
+			return nil, err
+		}
+	}
+	if !IsPlaceholder(fields[18]) {
+		r.FaultCode = fields[18]
+	}
+	if !IsPlaceholder(fields[19]) {
+		r.WarningCode = fields[19]
+	}
+	return &r, nil
+}
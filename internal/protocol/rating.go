@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 额定信息查询指令
+const (
+	CmdF = "F" // 额定电压、电流、电池电压、频率
+	CmdI = "I" // 厂商、型号、固件版本
+)
+
+// RatingInfo F 指令应答 "#MMM.M QQQ SS.SS RR.R"
+type RatingInfo struct {
+	Voltage        float64 // 额定电压 V
+	Current        float64 // 额定电流 A
+	BatteryVoltage float64 // 额定电池电压 V
+	Frequency      float64 // 额定频率 Hz
+}
+
+// UPSInfo I 指令应答 "#Company_Name UPS_Model Version"，三段分别为 15、10、10 个字符
+type UPSInfo struct {
+	Company string // 厂商
+	Model   string // 型号
+	Version string // 固件版本
+}
+
+// ParseRating 解析 F 应答帧
+func ParseRating(frame string) (*RatingInfo, error) {
+	fields, err := fieldsN(CmdF, frame, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	var r RatingInfo
+	for _, f := range []struct {
+		index int
+		dst   *float64
+	}{
+		{0, &r.Voltage},
+		{1, &r.Current},
+		{3, &r.Frequency},
+	} {
+		if *f.dst, err = parseFloat(fields[f.index]); err != nil {
+			return nil, err
+		}
+	}
+	if r.BatteryVoltage, err = parseFloatPrec(fields[2], 2); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ParseUPSInfo 解析 I 应答帧，优先按固定宽度切分，长度不足时按空白切分
+func ParseUPSInfo(frame string) (*UPSInfo, error) {
+	frame = strings.TrimSuffix(frame, Terminator)
+	if frame == "(NAK" {
+		return nil, ErrNAK
+	}
+	if !strings.HasPrefix(frame, "#") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidValue, frame)
+	}
+	body := frame[1:]
+
+	// 15 + 空格 + 10 + 空格 + 10
+	if len(body) >= 37 {
+		return &UPSInfo{
+			Company: strings.TrimSpace(body[0:15]),
+			Model:   strings.TrimSpace(body[16:26]),
+			Version: strings.TrimSpace(body[27:37]),
+		}, nil
+	}
+
+	fields := strings.Fields(body)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("%w: %s 需要 3 个字段，收到 %d 个", ErrFieldCount, CmdI, len(fields))
+	}
+	return &UPSInfo{Company: fields[0], Model: fields[1], Version: fields[2]}, nil
+}
@@ -0,0 +1,52 @@
+package protocol
+
+// waFieldCount WA 应答字段数量
+const waFieldCount = 13
+
+// WAReading WA 指令应答
+// "(WWW.W WWW.W WWW.W VVV.V VVV.V VVV.V TTT.T UUU.U CCC.C CCC.C CCC.C LLL b7b6b5b4b3b2b1b0"
+// 单相机型不支持的 L2/L3 字段以占位符表示，对应 Value.Valid 为 false。
+type WAReading struct {
+	LoadPower              [3]Value // L1~L3 负载有功功率 kW
+	LoadApparentPower      [3]Value // L1~L3 负载视在功率 kVA
+	LoadPowerTotal         Value    // 总有功功率 kW
+	LoadApparentPowerTotal Value    // 总视在功率 kVA
+	OutputCurrent          [3]Value // L1~L3 输出电流 A
+	LoadPercentage         Value    // 负载百分比 %
+	Status                 StatusBits
+}
+
+// ParseWA 解析 WA 应答帧
+func ParseWA(frame string) (*WAReading, error) {
+	fields, err := fieldsN(CmdWA, frame, waFieldCount)
+	if err != nil {
+		return nil, err
+	}
+
+	var r WAReading
+	for _, f := range []struct {
+		index int
+		dst   *Value
+	}{
+		{0, &r.LoadPower[0]},
+		{1, &r.LoadPower[1]},
+		{2, &r.LoadPower[2]},
+		{3, &r.LoadApparentPower[0]},
+		{4, &r.LoadApparentPower[1]},
+		{5, &r.LoadApparentPower[2]},
+		{6, &r.LoadPowerTotal},
+		{7, &r.LoadApparentPowerTotal},
+		{8, &r.OutputCurrent[0]},
+		{9, &r.OutputCurrent[1]},
+		{10, &r.OutputCurrent[2]},
+		{11, &r.LoadPercentage},
+	} {
+		if *f.dst, err = parseValue(fields[f.index]); err != nil {
+			return nil, err
+		}
+	}
+	if r.Status, err = ParseStatusBits(fields[12]); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
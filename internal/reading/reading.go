@@ -0,0 +1,47 @@
+// Package reading 读取遥测数据中的数值和状态位。
+//
+// 遥测值在插件内部以 int（状态位）或 float64（测量值）保存，经过 JSON 编解码后
+// 统一变为 float64，各模块通过本包读取，不关心值的来源。
+package reading
+
+import "strings"
+
+// StatusSuffix 状态位键名的后缀，如 utilityfailstatus，取值 0/1
+const StatusSuffix = "status"
+
+// IsStatus 判断键名是否为状态位
+func IsStatus(key string) bool {
+	return strings.HasSuffix(key, StatusSuffix)
+}
+
+// Number 读取数值，兼容 float64、int 和 int64
+func Number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// Flag 读取状态位，非 0 为 true，兼容数值和 bool。ok 为 false 表示读数中没有该状态位
+func Flag(readings map[string]interface{}, key string) (active bool, ok bool) {
+	v := readings[key]
+	if b, isBool := v.(bool); isBool {
+		return b, true
+	}
+	n, ok := Number(v)
+	return ok && n != 0, ok
+}
+
+// BoolToInt 将状态转换为 0/1 状态位
+func BoolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
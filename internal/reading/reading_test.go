@@ -0,0 +1,65 @@
+package reading
+
+import "testing"
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want float64
+		ok   bool
+	}{
+		{1.5, 1.5, true},
+		{2, 2, true},
+		{int64(3), 3, true},
+		{"4", 0, false},
+		{true, 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Number(tt.v)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Number(%#v) = %v, %v, 期望 %v, %v", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFlag(t *testing.T) {
+	readings := map[string]interface{}{
+		"int1":     1,
+		"int0":     0,
+		"int64":    int64(1),
+		"float1":   1.0,
+		"float0":   0.0,
+		"booltrue": true,
+		"string":   "1",
+	}
+	tests := []struct {
+		key    string
+		active bool
+		ok     bool
+	}{
+		{"int1", true, true},
+		{"int0", false, true},
+		{"int64", true, true},
+		{"float1", true, true},
+		{"float0", false, true},
+		{"booltrue", true, true},
+		{"string", false, false},
+		{"missing", false, false},
+	}
+	for _, tt := range tests {
+		active, ok := Flag(readings, tt.key)
+		if active != tt.active || ok != tt.ok {
+			t.Errorf("Flag(%s) = %v, %v, 期望 %v, %v", tt.key, active, ok, tt.active, tt.ok)
+		}
+	}
+}
+
+func TestIsStatus(t *testing.T) {
+	if !IsStatus("utilityfailstatus") || IsStatus("loadpower") {
+		t.Error("IsStatus 判断错误")
+	}
+	if BoolToInt(true) != 1 || BoolToInt(false) != 0 {
+		t.Error("BoolToInt 转换错误")
+	}
+}
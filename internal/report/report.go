@@ -0,0 +1,111 @@
+// Package report 实现按变化上报：只上报变化超过死区的遥测键，并定期上报全部最新值。
+package report
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"tp-santak-rtu/internal/config"
+	"tp-santak-rtu/internal/reading"
+)
+
+// phaseSuffixes 分相键名的后缀，使用不带后缀的死区配置
+var phaseSuffixes = []string{"_l2", "_l3"}
+
+// deviceReport 单个设备已上报的值
+type deviceReport struct {
+	sent         map[string]interface{}
+	lastSnapshot time.Time
+}
+
+// Filter 按设备过滤遥测数据，并发安全
+type Filter struct {
+	cfg       config.ReportConfig
+	deadbands map[string]config.DeadbandConfig
+
+	mu      sync.Mutex
+	devices map[string]*deviceReport
+}
+
+// NewFilter 创建过滤器，cfg.Enabled 为 false 时 Apply 原样返回数据
+func NewFilter(cfg config.ReportConfig) *Filter {
+	f := &Filter{
+		cfg:       cfg,
+		deadbands: make(map[string]config.DeadbandConfig, len(cfg.Deadbands)),
+		devices:   make(map[string]*deviceReport),
+	}
+	for _, d := range cfg.Deadbands {
+		f.deadbands[d.Key] = d
+	}
+	return f
+}
+
+// Apply 返回本次需要上报的键值，没有需要上报的数据时返回空。
+// readings 为设备全部最新值，设备首次上报或到达强制上报周期时上报 readings。
+func (f *Filter) Apply(deviceID string, data, readings map[string]interface{}, now time.Time) map[string]interface{} {
+	if !f.cfg.Enabled {
+		return data
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dev, ok := f.devices[deviceID]
+	if !ok || (f.cfg.SnapshotInterval > 0 && now.Sub(dev.lastSnapshot) >= f.cfg.SnapshotInterval) {
+		dev = &deviceReport{sent: make(map[string]interface{}, len(readings)), lastSnapshot: now}
+		f.devices[deviceID] = dev
+		for k, v := range readings {
+			dev.sent[k] = v
+		}
+		return readings
+	}
+
+	changed := make(map[string]interface{})
+	for k, v := range data {
+		last, ok := dev.sent[k]
+		if ok && !f.exceeds(k, last, v) {
+			continue
+		}
+		changed[k] = v
+		dev.sent[k] = v
+	}
+	return changed
+}
+
+// Forget 清除设备的上报记录，设备下次上报时上报全部最新值
+func (f *Filter) Forget(deviceID string) {
+	f.mu.Lock()
+	delete(f.devices, deviceID)
+	f.mu.Unlock()
+}
+
+// exceeds 判断新值与上次上报值的差是否超过键的死区
+func (f *Filter) exceeds(key string, last, v interface{}) bool {
+	lf, lok := reading.Number(last)
+	vf, vok := reading.Number(v)
+	if !lok || !vok {
+		return last != v
+	}
+	// 状态位变化总是立即上报
+	if reading.IsStatus(key) {
+		return lf != vf
+	}
+	db, ok := f.deadbands[baseKey(key)]
+	if !ok || (db.Absolute <= 0 && db.Percent <= 0) {
+		return lf != vf
+	}
+	diff := math.Abs(vf - lf)
+	if db.Absolute > 0 && diff >= db.Absolute {
+		return true
+	}
+	return db.Percent > 0 && diff >= math.Abs(lf)*db.Percent/100 && diff > 0
+}
+
+// baseKey 去掉分相后缀
+func baseKey(key string) string {
+	for _, suffix := range phaseSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return strings.TrimSuffix(key, suffix)
+		}
+	}
+	return key
+}
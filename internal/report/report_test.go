@@ -0,0 +1,59 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"tp-santak-rtu/internal/config"
+)
+
+func TestFilterDeadbands(t *testing.T) {
+	f := NewFilter(config.ReportConfig{
+		Enabled:          true,
+		SnapshotInterval: time.Hour,
+		Deadbands: []config.DeadbandConfig{
+			{Key: "inputvoltage", Absolute: 2},
+			{Key: "loadpower", Percent: 10},
+		},
+	})
+	now := time.Now()
+	first := map[string]interface{}{"inputvoltage": 220.0, "inputvoltage_l2": 220.0, "loadpower": 10.0, "utilityfailstatus": 0}
+	if got := f.Apply("dev-1", first, first, now); !reflect.DeepEqual(got, first) {
+		t.Fatalf("首次上报 = %v, 期望全部值", got)
+	}
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want map[string]interface{}
+	}{
+		{"未超过绝对死区", map[string]interface{}{"inputvoltage": 221.5}, map[string]interface{}{}},
+		{"超过绝对死区", map[string]interface{}{"inputvoltage": 222.0}, map[string]interface{}{"inputvoltage": 222.0}},
+		{"分相键使用同一死区", map[string]interface{}{"inputvoltage_l2": 217.0}, map[string]interface{}{"inputvoltage_l2": 217.0}},
+		{"未超过百分比死区", map[string]interface{}{"loadpower": 10.9}, map[string]interface{}{}},
+		{"超过百分比死区", map[string]interface{}{"loadpower": 11.0}, map[string]interface{}{"loadpower": 11.0}},
+		{"状态位变化", map[string]interface{}{"utilityfailstatus": 1}, map[string]interface{}{"utilityfailstatus": 1}},
+		{"状态位不变", map[string]interface{}{"utilityfailstatus": 1.0}, map[string]interface{}{}},
+		{"未配置死区的键", map[string]interface{}{"batterylevel": 100.0}, map[string]interface{}{"batterylevel": 100.0}},
+	}
+	for _, tt := range tests {
+		if got := f.Apply("dev-1", tt.data, nil, now); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Apply = %v, 期望 %v", tt.name, got, tt.want)
+		}
+	}
+
+	readings := map[string]interface{}{"inputvoltage": 222.5}
+	if got := f.Apply("dev-1", readings, readings, now.Add(time.Hour)); !reflect.DeepEqual(got, readings) {
+		t.Errorf("强制上报 = %v, 期望全部最新值", got)
+	}
+}
+
+func TestFilterDisabled(t *testing.T) {
+	f := NewFilter(config.ReportConfig{})
+	data := map[string]interface{}{"loadpower": 1.0}
+	for i := 0; i < 2; i++ {
+		if got := f.Apply("dev-1", data, data, time.Now()); !reflect.DeepEqual(got, data) {
+			t.Errorf("未启用时 Apply = %v, 期望原样返回", got)
+		}
+	}
+}
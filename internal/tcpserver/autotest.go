@@ -0,0 +1,228 @@
+package tcpserver
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+	"tp-santak-rtu/internal/battery"
+	"tp-santak-rtu/internal/config"
+	"tp-santak-rtu/internal/cron"
+	"tp-santak-rtu/internal/reading"
+	"tp-santak-rtu/internal/upsstate"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// autoTestInterval 检查定时自检计划的周期，小于 cron 的一分钟精度
+const autoTestInterval = 30 * time.Second
+
+// 设备配置表单中的自检计划，填写任一项时替换配置文件中的计划
+const (
+	formTestSchedule     = "test_schedule"      // 10 秒自检 (T)
+	formDeepTestSchedule = "deep_test_schedule" // 自检直到电池电压低 (TL)
+)
+
+// testSchedule 一条解析后的自检计划
+type testSchedule struct {
+	name    string
+	cron    *cron.Schedule
+	method  string
+	command string
+}
+
+// scheduleCache 解析过的自检计划，无效的计划 cron 为 nil
+type scheduleCache struct {
+	mu     sync.Mutex
+	parsed map[string]testSchedule
+}
+
+// runAutoTests 定期检查在线设备的自检计划，到期时发送自检指令，直到 done 关闭
+func (s *TCPServer) runAutoTests(done <-chan struct{}) {
+	ticker := time.NewTicker(autoTestInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			s.checkAutoTests(last, now)
+			last = now
+		}
+	}
+}
+
+// dueTest 到期的自检计划
+type dueTest struct {
+	deviceID string
+	schedule testSchedule
+}
+
+// checkAutoTests 执行 (prev, now] 内到期的自检计划
+func (s *TCPServer) checkAutoTests(prev, now time.Time) {
+	for _, due := range s.dueTests(prev, now) {
+		// 控制指令需要等待会话执行，不阻塞其他设备
+		go s.runScheduledTest(due.deviceID, due.schedule, now)
+	}
+}
+
+// dueTests 返回在线设备 (prev, now] 内到期的自检计划，离线设备错过的计划不补做
+func (s *TCPServer) dueTests(prev, now time.Time) []dueTest {
+	var due []dueTest
+	for _, ss := range s.sessions.list() {
+		device, err := s.platform.GetDeviceByVoucher(ss.voucher)
+		if err != nil || device.ID != ss.deviceID {
+			continue
+		}
+		offset := staggerOffset(ss.deviceID, s.opts.BatteryTest.Stagger)
+		for _, c := range s.testSchedules(device) {
+			ts, ok := s.resolveSchedule(c)
+			if !ok {
+				continue
+			}
+			next := ts.cron.Next(prev.Add(-offset))
+			if next.IsZero() || next.Add(offset).After(now) {
+				continue
+			}
+			due = append(due, dueTest{deviceID: ss.deviceID, schedule: ts})
+		}
+	}
+	return due
+}
+
+// testSchedules 返回设备的自检计划：设备配置表单 > 配置文件中按设备编号的覆盖 > 全局计划。
+// 配置文件中的 test_until_low 计划只对开启 deepTest 的设备执行
+func (s *TCPServer) testSchedules(device *types.Device) []config.TestScheduleConfig {
+	quick := configString(device.Config, formTestSchedule)
+	deep := configString(device.Config, formDeepTestSchedule)
+	if quick != "" || deep != "" {
+		var schedules []config.TestScheduleConfig
+		if quick != "" {
+			schedules = append(schedules, config.TestScheduleConfig{Name: formTestSchedule, Cron: quick, Method: "test"})
+		}
+		if deep != "" {
+			schedules = append(schedules, config.TestScheduleConfig{Name: formDeepTestSchedule, Cron: deep, Method: "test_until_low"})
+		}
+		return schedules
+	}
+	schedules := s.opts.BatteryTest.Schedules
+	allowDeep := false
+	for _, d := range s.opts.BatteryTest.Devices {
+		if d.DeviceNumber != device.DeviceNumber {
+			continue
+		}
+		if d.Disabled {
+			return nil
+		}
+		if len(d.Schedules) > 0 {
+			schedules = d.Schedules
+		}
+		allowDeep = d.DeepTest
+		break
+	}
+	if allowDeep {
+		return schedules
+	}
+	var allowed []config.TestScheduleConfig
+	for _, c := range schedules {
+		if c.Method != "test_until_low" {
+			allowed = append(allowed, c)
+		}
+	}
+	return allowed
+}
+
+// resolveSchedule 解析自检计划的 cron 表达式和自检指令，无效的计划返回 false 并只记录一次日志
+func (s *TCPServer) resolveSchedule(c config.TestScheduleConfig) (testSchedule, bool) {
+	s.crons.mu.Lock()
+	defer s.crons.mu.Unlock()
+	key := c.Cron + "|" + c.Method + "|" + strconv.Itoa(c.Minutes)
+	if ts, ok := s.crons.parsed[key]; ok {
+		ts.name = c.Name
+		return ts, ts.cron != nil
+	}
+	var ts testSchedule
+	sched, err := cron.Parse(c.Cron)
+	if err == nil {
+		ts.method = c.Method
+		ts.command, err = controlCommand(c.Method, map[string]interface{}{"minutes": float64(c.Minutes)})
+	}
+	if err == nil && !isTestMethod(c.Method) {
+		err = fmt.Errorf("不是自检命令: %s", c.Method)
+	}
+	if err != nil {
+		s.logger.Warnf("忽略无效的自检计划%s: %v", c.Name, err)
+		s.crons.parsed[key] = testSchedule{}
+		return testSchedule{}, false
+	}
+	ts.cron = sched
+	s.crons.parsed[key] = ts
+	ts.name = c.Name
+	return ts, true
+}
+
+// isTestMethod 定时任务只允许电池自检命令
+func isTestMethod(method string) bool {
+	switch method {
+	case "test", "test_until_low", "test_minutes":
+		return true
+	default:
+		return false
+	}
+}
+
+// runScheduledTest 检查自检条件后发送自检指令，并记录执行结果
+func (s *TCPServer) runScheduledTest(deviceID string, ts testSchedule, now time.Time) {
+	rec := battery.ScheduledTest{Time: now, Schedule: ts.name, Method: ts.method, Command: ts.command}
+	if reason := s.autoTestBlocked(deviceID); reason != "" {
+		rec.Outcome, rec.Reason = battery.OutcomeSkipped, reason
+	} else if err := s.SendControl(deviceID, ts.command); err != nil {
+		rec.Outcome, rec.Reason = battery.OutcomeFailed, err.Error()
+	} else {
+		rec.Outcome = battery.OutcomeStarted
+	}
+	s.logger.Infof("%s 定时自检%s(%s): %s %s", deviceID, ts.name, ts.command, rec.Outcome, rec.Reason)
+	if err := s.health.RecordScheduled(deviceID, rec); err != nil {
+		s.logger.WithError(err).Error("保存定时自检记录失败")
+	}
+	if err := s.platform.SendEvent(deviceID, battery.EventTestScheduled, rec.Params()); err != nil {
+		s.logger.Errorf("%s 发送事件%s失败: %v", deviceID, battery.EventTestScheduled, err)
+	}
+}
+
+// autoTestBlocked 按最近一次轮询的状态位判断是否跳过自检，返回跳过原因
+func (s *TCPServer) autoTestBlocked(deviceID string) string {
+	readings := s.devices.get(deviceID).snapshot()
+	if _, ok := reading.Flag(readings, upsstate.KeyUtilityFail); !ok {
+		return "尚未收到UPS状态"
+	}
+	for _, c := range []struct{ key, reason string }{
+		{upsstate.KeyUtilityFail, "UPS电池供电中"},
+		{upsstate.KeyUPSFailed, "UPS故障"},
+		{upsstate.KeyTestInProgress, "自检进行中"},
+		{upsstate.KeyShutdown, "关机倒计时中"},
+	} {
+		if active, _ := reading.Flag(readings, c.key); active {
+			return c.reason
+		}
+	}
+	return ""
+}
+
+// ScheduledTests 返回设备保存的定时自检执行记录，按时间先后排列
+func (s *TCPServer) ScheduledTests(deviceID string) ([]battery.ScheduledTest, error) {
+	return s.health.ScheduledHistory(deviceID)
+}
+
+// staggerOffset 按设备ID散列出固定的执行时间偏移(整分钟)，同一站点的设备不会同时自检
+func staggerOffset(deviceID string, stagger time.Duration) time.Duration {
+	minutes := uint32(stagger / time.Minute)
+	if minutes == 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(deviceID))
+	return time.Duration(h.Sum32()%minutes) * time.Minute
+}
@@ -0,0 +1,288 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+	"tp-santak-rtu/internal/battery"
+	"tp-santak-rtu/internal/config"
+	"tp-santak-rtu/internal/protocol"
+	"tp-santak-rtu/internal/upsstate"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// fakeDevices 模拟平台的设备配置接口，按凭证返回设备
+type fakeDevices map[string]types.Device
+
+func (f fakeDevices) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Voucher string `json:"voucher"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    200,
+		"message": "success",
+		"data":    f[req.Voucher],
+	})
+}
+
+var monthly = config.TestScheduleConfig{Name: "monthly", Cron: "0 3 1 * *", Method: "test"}
+
+// newAutoTestServer 创建 TCP 服务器，devices 为平台上的设备，按凭证查询
+func newAutoTestServer(t *testing.T, devices fakeDevices, bt config.BatteryTestConfig) *TCPServer {
+	t.Helper()
+	api := httptest.NewServer(devices)
+	t.Cleanup(api.Close)
+	s, _ := newTestServerAPI(t, api.URL, Options{
+		Battery:     config.BatteryConfig{Dir: t.TempDir()},
+		BatteryTest: bt,
+	})
+	return s
+}
+
+// connect 登记设备会话，返回会话收到的控制指令，UPS 接受全部指令
+func connect(t *testing.T, s *TCPServer, deviceID, voucher string) <-chan string {
+	t.Helper()
+	ss := newTestSession(s, deviceID)
+	ss.voucher = voucher
+	ss.control = make(chan *controlRequest, 1)
+	s.sessions.register(ss)
+	commands := make(chan string, 10)
+	go func() {
+		for {
+			select {
+			case req := <-ss.control:
+				commands <- req.command
+				req.result <- nil
+			case <-ss.closed:
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() { close(ss.closed) })
+	return commands
+}
+
+// statusBits 设置设备最近一次轮询的状态位
+func statusBits(s *TCPServer, deviceID string, bits map[string]interface{}) {
+	readings := map[string]interface{}{
+		upsstate.KeyUtilityFail:    0,
+		upsstate.KeyUPSFailed:      0,
+		upsstate.KeyTestInProgress: 0,
+		upsstate.KeyShutdown:       0,
+	}
+	for k, v := range bits {
+		readings[k] = v
+	}
+	s.devices.get(deviceID).merge(readings)
+}
+
+// dueNames 返回到期的设备和计划名称
+func dueNames(due []dueTest) map[string]string {
+	names := make(map[string]string, len(due))
+	for _, d := range due {
+		names[d.deviceID] = d.schedule.name
+	}
+	return names
+}
+
+func TestDueTests(t *testing.T) {
+	s := newAutoTestServer(t, fakeDevices{
+		"v1": {ID: "dev-1", DeviceNumber: "UPS001"},
+		"v2": {ID: "dev-2", DeviceNumber: "UPS002"},
+	}, config.BatteryTestConfig{Schedules: []config.TestScheduleConfig{monthly}})
+	connect(t, s, "dev-1", "v1")
+	connect(t, s, "dev-2", "v2")
+
+	at := time.Date(2024, 5, 1, 3, 0, 0, 0, time.Local)
+	tests := []struct {
+		name      string
+		prev, now time.Time
+		want      int
+	}{
+		{"到期", at.Add(-20 * time.Second), at.Add(10 * time.Second), 2},
+		{"整点", at.Add(-30 * time.Second), at, 2},
+		{"已执行过", at.Add(10 * time.Second), at.Add(40 * time.Second), 0},
+		{"未到期", at.Add(-time.Hour), at.Add(-time.Hour + 30*time.Second), 0},
+		{"其他日期", at.AddDate(0, 0, 1).Add(-20 * time.Second), at.AddDate(0, 0, 1).Add(10 * time.Second), 0},
+	}
+	for _, tt := range tests {
+		if due := s.dueTests(tt.prev, tt.now); len(due) != tt.want {
+			t.Errorf("%s: 到期 %v, 期望 %d 个", tt.name, dueNames(due), tt.want)
+		}
+	}
+
+	// 凭证已不属于会话的设备不执行
+	s.sessions.get("dev-2").voucher = "v1"
+	if due := dueNames(s.dueTests(at.Add(-20*time.Second), at)); len(due) != 1 || due["dev-1"] != "monthly" {
+		t.Errorf("到期 %v, 期望只有 dev-1", due)
+	}
+}
+
+func TestDueTestsStagger(t *testing.T) {
+	const stagger = 30 * time.Minute
+	s := newAutoTestServer(t, fakeDevices{"v1": {ID: "dev-1"}}, config.BatteryTestConfig{
+		Stagger:   stagger,
+		Schedules: []config.TestScheduleConfig{monthly},
+	})
+	connect(t, s, "dev-1", "v1")
+
+	offset := staggerOffset("dev-1", stagger)
+	at := time.Date(2024, 5, 1, 3, 0, 0, 0, time.Local).Add(offset)
+	if due := s.dueTests(at.Add(-20*time.Second), at.Add(10*time.Second)); len(due) != 1 {
+		t.Errorf("偏移 %s 后应到期: %v", offset, dueNames(due))
+	}
+	if offset > 0 {
+		if due := s.dueTests(at.Add(-offset-20*time.Second), at.Add(-offset+10*time.Second)); len(due) != 0 {
+			t.Errorf("偏移 %s 前不应到期: %v", offset, dueNames(due))
+		}
+	}
+}
+
+func TestStaggerOffset(t *testing.T) {
+	const stagger = 30 * time.Minute
+	seen := make(map[time.Duration]bool)
+	for _, id := range []string{"dev-1", "dev-2", "dev-3", "dev-4", "dev-5", "dev-6", "dev-7", "dev-8"} {
+		offset := staggerOffset(id, stagger)
+		if offset < 0 || offset >= stagger || offset%time.Minute != 0 {
+			t.Errorf("staggerOffset(%s) = %s, 期望 [0, 30m) 内的整分钟", id, offset)
+		}
+		if offset != staggerOffset(id, stagger) {
+			t.Errorf("staggerOffset(%s) 不固定", id)
+		}
+		seen[offset] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("不同设备的偏移应错开: %v", seen)
+	}
+	if offset := staggerOffset("dev-1", 30*time.Second); offset != 0 {
+		t.Errorf("错开范围不足一分钟时偏移 = %s, 期望 0", offset)
+	}
+}
+
+func TestTestSchedules(t *testing.T) {
+	quarterly := config.TestScheduleConfig{Name: "quarterly", Cron: "0 3 15 1,4,7,10 *", Method: "test_until_low"}
+	s := newAutoTestServer(t, nil, config.BatteryTestConfig{
+		Schedules: []config.TestScheduleConfig{monthly, quarterly},
+		Devices: []config.DeviceTestConfig{
+			{DeviceNumber: "UPS002", Disabled: true},
+			{DeviceNumber: "UPS003", Schedules: []config.TestScheduleConfig{quarterly}, DeepTest: true},
+			{DeviceNumber: "UPS004", Schedules: []config.TestScheduleConfig{monthly, quarterly}},
+			{DeviceNumber: "UPS005", DeepTest: true},
+		},
+	})
+	tests := []struct {
+		name   string
+		device types.Device
+		want   []string
+	}{
+		{"全局计划不含深度自检", types.Device{DeviceNumber: "UPS001"}, []string{"monthly"}},
+		{"按设备禁用", types.Device{DeviceNumber: "UPS002"}, nil},
+		{"按设备覆盖", types.Device{DeviceNumber: "UPS003"}, []string{"quarterly"}},
+		{"未开启深度自检", types.Device{DeviceNumber: "UPS004"}, []string{"monthly"}},
+		{"开启深度自检", types.Device{DeviceNumber: "UPS005"}, []string{"monthly", "quarterly"}},
+		{
+			"设备配置表单优先",
+			types.Device{DeviceNumber: "UPS002", Config: map[string]interface{}{formDeepTestSchedule: "0 4 * * 0"}},
+			[]string{formDeepTestSchedule},
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range s.testSchedules(&tt.device) {
+			got = append(got, c.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: 计划 %v, 期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveSchedule(t *testing.T) {
+	s := newAutoTestServer(t, nil, config.BatteryTestConfig{})
+	tests := []struct {
+		c       config.TestScheduleConfig
+		command string
+		ok      bool
+	}{
+		{monthly, protocol.CmdTest, true},
+		{config.TestScheduleConfig{Cron: "0 3 * * *", Method: "test_until_low"}, protocol.CmdTestUntilLow, true},
+		{config.TestScheduleConfig{Cron: "0 3 * * *", Method: "test_minutes", Minutes: 5}, "T05", true},
+		{config.TestScheduleConfig{Cron: "0 3 * * *", Method: "test_minutes"}, "", false},
+		{config.TestScheduleConfig{Cron: "0 3 * * *", Method: "shutdown"}, "", false},
+		{config.TestScheduleConfig{Cron: "0 25 * * *", Method: "test"}, "", false},
+	}
+	for _, tt := range tests {
+		// 第二次从缓存读取，结果相同
+		for i := 0; i < 2; i++ {
+			ts, ok := s.resolveSchedule(tt.c)
+			if ok != tt.ok || ts.command != tt.command {
+				t.Errorf("resolveSchedule(%+v) = %q %v, 期望 %q %v", tt.c, ts.command, ok, tt.command, tt.ok)
+			}
+		}
+	}
+}
+
+func TestRunScheduledTest(t *testing.T) {
+	s := newAutoTestServer(t, nil, config.BatteryTestConfig{})
+	commands := connect(t, s, "dev-1", "v1")
+	ts, _ := s.resolveSchedule(monthly)
+	now := time.Date(2024, 5, 1, 3, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		bits    map[string]interface{}
+		outcome string
+	}{
+		{"尚未收到状态位", nil, battery.OutcomeSkipped},
+		{"电池供电", map[string]interface{}{upsstate.KeyUtilityFail: 1}, battery.OutcomeSkipped},
+		{"UPS故障", map[string]interface{}{upsstate.KeyUPSFailed: 1}, battery.OutcomeSkipped},
+		{"自检进行中", map[string]interface{}{upsstate.KeyTestInProgress: 1}, battery.OutcomeSkipped},
+		{"关机倒计时", map[string]interface{}{upsstate.KeyShutdown: 1}, battery.OutcomeSkipped},
+		{"满足条件", map[string]interface{}{}, battery.OutcomeStarted},
+	}
+	for i, tt := range tests {
+		if tt.bits != nil {
+			statusBits(s, "dev-1", tt.bits)
+		}
+		s.runScheduledTest("dev-1", ts, now)
+		records, err := s.ScheduledTests("dev-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != i+1 {
+			t.Fatalf("%s: 执行记录 %d 条, 期望 %d", tt.name, len(records), i+1)
+		}
+		r := records[i]
+		if r.Outcome != tt.outcome || r.Schedule != "monthly" || r.Command != protocol.CmdTest {
+			t.Errorf("%s: 记录 %+v, 期望 %s", tt.name, r, tt.outcome)
+		}
+		if tt.outcome == battery.OutcomeSkipped && r.Reason == "" {
+			t.Errorf("%s: 跳过时应记录原因", tt.name)
+		}
+	}
+	select {
+	case cmd := <-commands:
+		if cmd != protocol.CmdTest {
+			t.Errorf("发送指令 %q, 期望 T", cmd)
+		}
+	default:
+		t.Error("满足条件时应发送自检指令")
+	}
+	if len(commands) != 0 {
+		t.Error("跳过时不应发送自检指令")
+	}
+
+	// 设备离线时记录失败
+	s.runScheduledTest("dev-2", ts, now)
+	statusBits(s, "dev-2", nil)
+	s.runScheduledTest("dev-2", ts, now)
+	records, _ := s.ScheduledTests("dev-2")
+	if len(records) != 2 || records[1].Outcome != battery.OutcomeFailed {
+		t.Errorf("离线设备记录 %+v, 期望失败", records)
+	}
+}
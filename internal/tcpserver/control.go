@@ -0,0 +1,123 @@
+package tcpserver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"tp-santak-rtu/internal/platform"
+	"tp-santak-rtu/internal/protocol"
+)
+
+// controlWait 等待会话执行控制指令的最长时间，包含排队等待当前轮询应答的时间
+const controlWait = 30 * time.Second
+
+// ErrDeviceNotConnected 设备没有在线的TCP会话
+var ErrDeviceNotConnected = errors.New("设备未连接")
+
+// controlRequest 插入轮询间隙执行的控制指令
+type controlRequest struct {
+	command string
+	result  chan error // 缓冲为1，会话写入执行结果
+}
+
+// HandleCommand 处理平台下发的设备命令，转换为控制指令写入设备会话并回复执行结果
+func (s *TCPServer) HandleCommand(cmd *platform.Command) {
+	command, err := controlCommand(cmd.Method, cmd.Params)
+	if err == nil {
+		err = s.SendControl(cmd.DeviceID, command)
+	}
+	if err != nil {
+		s.logger.Errorf("%s 执行命令%s失败: %v", cmd.DeviceID, cmd.Method, err)
+	} else {
+		s.logger.Infof("%s 执行命令%s成功: %s", cmd.DeviceID, cmd.Method, command)
+	}
+	if rspErr := s.platform.SendCommandResponse(cmd, err); rspErr != nil {
+		s.logger.Errorf("%s 回复命令结果失败: %v", cmd.DeviceID, rspErr)
+	}
+}
+
+// SendControl 将控制指令写入设备当前会话，等待 UPS 接受或拒绝
+func (s *TCPServer) SendControl(deviceID string, command string) error {
+	ss := s.sessions.get(deviceID)
+	if ss == nil {
+		return ErrDeviceNotConnected
+	}
+	req := &controlRequest{command: command, result: make(chan error, 1)}
+	select {
+	case ss.control <- req:
+	case <-ss.closed:
+		return ErrDeviceNotConnected
+	default:
+		return fmt.Errorf("设备 %s 控制指令队列已满", deviceID)
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-ss.closed:
+		return ErrDeviceNotConnected
+	case <-time.After(controlWait):
+		return fmt.Errorf("设备 %s 执行控制指令超时", deviceID)
+	}
+}
+
+// controlCommand 将平台命令转换为 UPS 控制指令
+//
+//	test                          电池自检 10 秒 (T)
+//	test_until_low                电池自检直到电压低 (TL)
+//	test_minutes    {minutes}     定时自检 (T<n>)
+//	cancel_test                   取消自检 (CT)
+//	shutdown        {delay, restore} 延时关机并恢复 (S<n>R<m>)
+//	cancel_shutdown               取消关机 (C)
+//	toggle_beeper                 切换蜂鸣器 (Q)
+func controlCommand(method string, params map[string]interface{}) (string, error) {
+	switch method {
+	case "test":
+		return protocol.CmdTest, nil
+	case "test_until_low":
+		return protocol.CmdTestUntilLow, nil
+	case "test_minutes":
+		minutes, err := numberParam(params, "minutes")
+		if err != nil {
+			return "", err
+		}
+		return protocol.EncodeTestMinutes(int(minutes))
+	case "cancel_test":
+		return protocol.CmdCancelTest, nil
+	case "shutdown":
+		delay, err := numberParam(params, "delay")
+		if err != nil {
+			return "", err
+		}
+		var restore float64
+		if _, ok := params["restore"]; ok {
+			if restore, err = numberParam(params, "restore"); err != nil {
+				return "", err
+			}
+		}
+		return protocol.EncodeShutdown(delay, int(restore))
+	case "cancel_shutdown":
+		return protocol.CmdCancelShutdown, nil
+	case "toggle_beeper":
+		return protocol.CmdToggleBeeper, nil
+	default:
+		return "", fmt.Errorf("不支持的命令: %s", method)
+	}
+}
+
+// numberParam 读取数值参数，兼容平台以字符串下发的数字
+func numberParam(params map[string]interface{}, key string) (float64, error) {
+	switch v := params[key].(type) {
+	case float64:
+		return v, nil
+	case string:
+		var f float64
+		if _, err := fmt.Sscanf(v, "%g", &f); err != nil {
+			return 0, fmt.Errorf("参数 %s 不是数字: %q", key, v)
+		}
+		return f, nil
+	case nil:
+		return 0, fmt.Errorf("缺少参数: %s", key)
+	default:
+		return 0, fmt.Errorf("参数 %s 类型错误: %T", key, v)
+	}
+}
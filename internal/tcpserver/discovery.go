@@ -0,0 +1,132 @@
+package tcpserver
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+	"tp-santak-rtu/internal/protocol"
+)
+
+// maxDiscovered 最多记录的未绑定 DTU 数量，超出时淘汰最久未出现的
+const maxDiscovered = 256
+
+// probeCommands 未绑定 DTU 注册时发送的采样指令，应答帮助运维确认 UPS 型号
+var probeCommands = []string{protocol.CmdQ6, protocol.CmdWA}
+
+// DiscoveredDevice 已连接但平台未识别注册包的 DTU
+type DiscoveredDevice struct {
+	RegPacket  string            `json:"reg_packet"` // 注册包，即绑定时填写的凭证
+	RemoteAddr string            `json:"remote_addr"`
+	FirstSeen  time.Time         `json:"first_seen"`
+	LastSeen   time.Time         `json:"last_seen"`
+	Count      int               `json:"count"`   // 注册次数
+	Samples    map[string]string `json:"samples"` // 指令 -> 最近一次应答
+}
+
+// discovery 按注册包索引的未绑定 DTU
+type discovery struct {
+	mu      sync.Mutex
+	devices map[string]*DiscoveredDevice
+}
+
+func newDiscovery() *discovery {
+	return &discovery{devices: make(map[string]*DiscoveredDevice)}
+}
+
+// record 记录一次未识别的注册，采样应答为空的指令保留之前的样例
+func (d *discovery) record(reg, addr string, samples map[string]string, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dev, ok := d.devices[reg]
+	if !ok {
+		if len(d.devices) >= maxDiscovered {
+			d.evictOldest()
+		}
+		dev = &DiscoveredDevice{RegPacket: reg, FirstSeen: now, Samples: make(map[string]string)}
+		d.devices[reg] = dev
+	}
+	dev.RemoteAddr = addr
+	dev.LastSeen = now
+	dev.Count++
+	for cmd, frame := range samples {
+		dev.Samples[cmd] = frame
+	}
+}
+
+// evictOldest 移除最久未出现的记录，调用方持有锁
+func (d *discovery) evictOldest() {
+	var oldest *DiscoveredDevice
+	for _, dev := range d.devices {
+		if oldest == nil || dev.LastSeen.Before(oldest.LastSeen) {
+			oldest = dev
+		}
+	}
+	if oldest != nil {
+		delete(d.devices, oldest.RegPacket)
+	}
+}
+
+// remove 注册包已绑定到设备后移除记录
+func (d *discovery) remove(reg string) {
+	d.mu.Lock()
+	delete(d.devices, reg)
+	d.mu.Unlock()
+}
+
+// list 返回所有记录的副本，最近出现的在前
+func (d *discovery) list() []DiscoveredDevice {
+	d.mu.Lock()
+	list := make([]DiscoveredDevice, 0, len(d.devices))
+	for _, dev := range d.devices {
+		c := *dev
+		c.Samples = make(map[string]string, len(dev.Samples))
+		for cmd, frame := range dev.Samples {
+			c.Samples[cmd] = frame
+		}
+		list = append(list, c)
+	}
+	d.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].LastSeen.Equal(list[j].LastSeen) {
+			return list[i].LastSeen.After(list[j].LastSeen)
+		}
+		return list[i].RegPacket < list[j].RegPacket
+	})
+	return list
+}
+
+// Discovered 返回已连接但未绑定到平台设备的 DTU，最近出现的在前
+func (s *TCPServer) Discovered() []DiscoveredDevice {
+	return s.discovered.list()
+}
+
+// probe 依次发送采样指令并读取应答，超时或出错的指令不记录
+func (s *TCPServer) probe(conn net.Conn) map[string]string {
+	timeout := resolvePollConfig(s.opts.Poll, "").Timeout
+	samples := make(map[string]string)
+	f := newFramer(defaultMaxFrameSize)
+	var buf [512]byte
+	for _, cmd := range probeCommands {
+		if _, err := conn.Write(protocol.Encode(cmd)); err != nil {
+			return samples
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		for {
+			n, err := conn.Read(buf[:])
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					f.Reset()
+					break
+				}
+				return samples
+			}
+			frames, _ := f.Feed(buf[:n])
+			if len(frames) > 0 {
+				samples[cmd] = frames[len(frames)-1]
+				break
+			}
+		}
+	}
+	return samples
+}
@@ -0,0 +1,67 @@
+package tcpserver
+
+import (
+	"bytes"
+	"errors"
+)
+
+const (
+	frameStarts     = "(#" // 应答帧起始符，额定信息应答以 "#" 开头
+	frameTerminator = '\r'
+
+	// defaultMaxFrameSize 单帧最大长度，Q6 应答约 120 字节，留足余量
+	defaultMaxFrameSize = 512
+)
+
+// ErrFrameTooLarge 缓冲区中未结束的帧超过最大长度
+var ErrFrameTooLarge = errors.New("帧长度超出限制")
+
+// framer 按 "\r" 结束符对 TCP 字节流进行分帧，处理粘包和半包
+type framer struct {
+	buf     []byte
+	maxSize int
+}
+
+// newFramer 创建分帧器，maxSize <= 0 时使用默认最大帧长度
+func newFramer(maxSize int) *framer {
+	if maxSize <= 0 {
+		maxSize = defaultMaxFrameSize
+	}
+	return &framer{maxSize: maxSize}
+}
+
+// Feed 写入新收到的字节，返回其中所有完整的 "(...\r" 或 "#...\r" 帧(不含结束符)。
+// 帧起始符之前的字节(如 DTU 心跳包)会被丢弃；未结束的半包保留到下次调用。
+// 半包超过最大帧长度时清空缓冲区并返回 ErrFrameTooLarge，已解析出的帧仍然返回。
+func (f *framer) Feed(p []byte) ([]string, error) {
+	f.buf = append(f.buf, p...)
+
+	var frames []string
+	for {
+		start := bytes.IndexAny(f.buf, frameStarts)
+		if start < 0 {
+			// 没有起始符，缓冲区里只有噪声
+			f.buf = f.buf[:0]
+			return frames, nil
+		}
+		f.buf = f.buf[start:]
+
+		end := bytes.IndexByte(f.buf, frameTerminator)
+		if end < 0 {
+			break
+		}
+		frames = append(frames, string(f.buf[:end]))
+		f.buf = f.buf[end+1:]
+	}
+
+	if len(f.buf) > f.maxSize {
+		f.Reset()
+		return frames, ErrFrameTooLarge
+	}
+	return frames, nil
+}
+
+// Reset 丢弃缓冲区中的半包
+func (f *framer) Reset() {
+	f.buf = f.buf[:0]
+}
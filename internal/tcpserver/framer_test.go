@@ -0,0 +1,106 @@
+package tcpserver
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFramerFeed(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{
+			name:   "单个完整帧",
+			chunks: []string{"(230.0 230.0 050 50.0\r"},
+			want:   []string{"(230.0 230.0 050 50.0"},
+		},
+		{
+			name:   "半包",
+			chunks: []string{"(230.0 23", "0.0 050", " 50.0\r"},
+			want:   []string{"(230.0 230.0 050 50.0"},
+		},
+		{
+			name:   "粘包",
+			chunks: []string{"(1 2 3\r(4 5 6\r(7 8 9\r"},
+			want:   []string{"(1 2 3", "(4 5 6", "(7 8 9"},
+		},
+		{
+			name:   "粘包加半包",
+			chunks: []string{"(1 2 3\r(4 5", " 6\r"},
+			want:   []string{"(1 2 3", "(4 5 6"},
+		},
+		{
+			name:   "额定信息应答",
+			chunks: []string{"(1 2 3\r#220.0 009", " 024.0 50.0\r"},
+			want:   []string{"(1 2 3", "#220.0 009 024.0 50.0"},
+		},
+		{
+			name:   "起始符之前的噪声",
+			chunks: []string{"heartbeat\x00\x01(NAK\r"},
+			want:   []string{"(NAK"},
+		},
+		{
+			name:   "只有噪声",
+			chunks: []string{"heartbeat", "\r\n", "(OK\r"},
+			want:   []string{"(OK"},
+		},
+		{
+			name:   "结束符被拆到下一包",
+			chunks: []string{"(1 2 3", "\r"},
+			want:   []string{"(1 2 3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFramer(0)
+			var got []string
+			for _, chunk := range tt.chunks {
+				frames, err := f.Feed([]byte(chunk))
+				if err != nil {
+					t.Fatalf("Feed(%q) 返回错误: %v", chunk, err)
+				}
+				got = append(got, frames...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("帧 = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFramerOversize(t *testing.T) {
+	f := newFramer(16)
+
+	frames, err := f.Feed([]byte("(ok\r(" + strings.Repeat("x", 20)))
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("err = %v, 期望 ErrFrameTooLarge", err)
+	}
+	if !reflect.DeepEqual(frames, []string{"(ok"}) {
+		t.Errorf("超长前已完整的帧 = %q, 期望 [\"(ok\"]", frames)
+	}
+
+	// 超长的半包已丢弃，剩余部分不会拼到下一帧
+	frames, err = f.Feed([]byte("xxx\r(next\r"))
+	if err != nil {
+		t.Fatalf("重置后 Feed 返回错误: %v", err)
+	}
+	if !reflect.DeepEqual(frames, []string{"(next"}) {
+		t.Errorf("重置后的帧 = %q, 期望 [\"(next\"]", frames)
+	}
+}
+
+func TestFramerReset(t *testing.T) {
+	f := newFramer(0)
+	if frames, _ := f.Feed([]byte("(half")); len(frames) != 0 {
+		t.Fatalf("半包不应产生帧: %q", frames)
+	}
+	f.Reset()
+	frames, _ := f.Feed([]byte(" packet\r(new\r"))
+	if !reflect.DeepEqual(frames, []string{"(new"}) {
+		t.Errorf("Reset 后的帧 = %q, 期望 [\"(new\"]", frames)
+	}
+}
@@ -0,0 +1,59 @@
+package tcpserver
+
+import (
+	"sync"
+)
+
+// registry 按设备ID索引的在线会话。同一设备重复注册时新会话取代旧会话，
+// 只有当前登记的会话可以上报设备在线/离线状态。
+type registry struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newRegistry() *registry {
+	return &registry{sessions: make(map[string]*session)}
+}
+
+// register 登记会话，返回被取代的旧会话，没有则返回 nil
+func (r *registry) register(ss *session) *session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.sessions[ss.deviceID]
+	r.sessions[ss.deviceID] = ss
+	return old
+}
+
+// unregister 移除会话，返回该会话是否仍是设备的当前会话
+func (r *registry) unregister(ss *session) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions[ss.deviceID] != ss {
+		return false
+	}
+	delete(r.sessions, ss.deviceID)
+	return true
+}
+
+// get 返回设备的当前会话，不在线返回 nil
+func (r *registry) get(deviceID string) *session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sessions[deviceID]
+}
+
+// isCurrent 判断会话是否为设备的当前会话
+func (r *registry) isCurrent(ss *session) bool {
+	return r.get(ss.deviceID) == ss
+}
+
+// list 返回所有在线会话
+func (r *registry) list() []*session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, ss := range r.sessions {
+		sessions = append(sessions, ss)
+	}
+	return sessions
+}
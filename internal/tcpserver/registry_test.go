@@ -0,0 +1,65 @@
+package tcpserver
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRegistryReplace(t *testing.T) {
+	r := newRegistry()
+	old := &session{deviceID: "dev-1"}
+	cur := &session{deviceID: "dev-1"}
+
+	if got := r.register(old); got != nil {
+		t.Fatalf("首次注册返回 %p, 期望 nil", got)
+	}
+	if got := r.register(cur); got != old {
+		t.Fatalf("重复注册返回 %p, 期望旧会话 %p", got, old)
+	}
+	if r.isCurrent(old) || !r.isCurrent(cur) {
+		t.Error("重复注册后当前会话应为新会话")
+	}
+	// 旧会话退出时不能移除新会话
+	if r.unregister(old) {
+		t.Error("旧会话 unregister 返回 true, 期望 false")
+	}
+	if r.get("dev-1") != cur {
+		t.Error("旧会话退出后新会话被移除")
+	}
+	if !r.unregister(cur) || r.get("dev-1") != nil {
+		t.Error("新会话退出后应移除登记")
+	}
+}
+
+// TestReplacedSessionClosed 被取代的会话连接被关闭，且不再上报设备状态
+func TestReplacedSessionClosed(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	// platform 为 nil，被取代的会话若上报状态会 panic
+	s, err := NewTCPServer(nil, Options{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	old := &session{server: s, conn: server, deviceID: "dev-1"}
+	s.sessions.register(old)
+	if replaced := s.sessions.register(&session{server: s, deviceID: "dev-1"}); replaced != old {
+		t.Fatalf("register 返回 %p, 期望旧会话", replaced)
+	}
+	old.close(closeReplaced)
+	old.close("其他原因")
+
+	if reason, _ := old.closeReason.Load().(string); reason != closeReplaced {
+		t.Errorf("closeReason = %q, 期望 %q", reason, closeReplaced)
+	}
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("旧连接读取 err = %v, 期望 EOF", err)
+	}
+	old.sendStatus("0")
+	old.handleReadError(io.EOF)
+}
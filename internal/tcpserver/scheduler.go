@@ -0,0 +1,148 @@
+package tcpserver
+
+import (
+	"time"
+	"tp-santak-rtu/internal/config"
+	"tp-santak-rtu/internal/protocol"
+)
+
+// 未配置时使用的轮询参数
+const (
+	defaultPollGap     = 200 * time.Millisecond
+	defaultPollTimeout = 3 * time.Second
+)
+
+// defaultPollCommands 未配置轮询指令时使用
+var defaultPollCommands = []config.PollCommandConfig{
+	{Command: protocol.CmdQ6, Interval: 5 * time.Second},
+	{Command: protocol.CmdWA, Interval: 10 * time.Second},
+}
+
+// pollTask 一条周期轮询指令
+type pollTask struct {
+	command  string
+	interval time.Duration // 为0时只发送一次
+	timeout  time.Duration
+	next     time.Time // 下次发送时间
+}
+
+// scheduler 单个会话的轮询调度器，非并发安全，只在会话协程中使用
+type scheduler struct {
+	tasks   []*pollTask
+	gap     time.Duration
+	timeout time.Duration
+}
+
+// resolvePollConfig 合并全局轮询配置与设备覆盖配置，并补齐默认值
+func resolvePollConfig(cfg config.PollConfig, deviceNumber string) config.PollConfig {
+	resolved := config.PollConfig{
+		Gap:      cfg.Gap,
+		Timeout:  cfg.Timeout,
+		Commands: cfg.Commands,
+	}
+	for _, d := range cfg.Devices {
+		if d.DeviceNumber != deviceNumber {
+			continue
+		}
+		if d.Gap > 0 {
+			resolved.Gap = d.Gap
+		}
+		if d.Timeout > 0 {
+			resolved.Timeout = d.Timeout
+		}
+		if len(d.Commands) > 0 {
+			resolved.Commands = d.Commands
+		}
+		break
+	}
+
+	if resolved.Gap <= 0 {
+		resolved.Gap = defaultPollGap
+	}
+	if resolved.Timeout <= 0 {
+		resolved.Timeout = defaultPollTimeout
+	}
+	if len(resolved.Commands) == 0 {
+		resolved.Commands = defaultPollCommands
+	}
+	return resolved
+}
+
+// newScheduler 创建调度器，所有指令在 now 时刻按配置顺序依次到期。
+// 不支持的指令被忽略并通过 skipped 返回。
+func newScheduler(cfg config.PollConfig, now time.Time) (sched *scheduler, skipped []string) {
+	sched = &scheduler{
+		gap:     cfg.Gap,
+		timeout: cfg.Timeout,
+	}
+	for _, c := range cfg.Commands {
+		if !isPollCommand(c.Command) || c.Interval <= 0 {
+			skipped = append(skipped, c.Command)
+			continue
+		}
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = cfg.Timeout
+		}
+		sched.tasks = append(sched.tasks, &pollTask{
+			command:  c.Command,
+			interval: c.Interval,
+			timeout:  timeout,
+			next:     now,
+		})
+	}
+	return sched, skipped
+}
+
+// due 返回已到期且最早到期的指令，没有则返回 nil
+func (s *scheduler) due(now time.Time) *pollTask {
+	var task *pollTask
+	for _, t := range s.tasks {
+		if t.next.After(now) {
+			continue
+		}
+		if task == nil || t.next.Before(task.next) {
+			task = t
+		}
+	}
+	return task
+}
+
+// once 安排一条只发送一次的指令，已在轮询列表中的指令不重复添加
+func (s *scheduler) once(command string, now time.Time) {
+	for _, t := range s.tasks {
+		if t.command == command {
+			return
+		}
+	}
+	s.tasks = append(s.tasks, &pollTask{
+		command: command,
+		timeout: s.timeout,
+		next:    now,
+	})
+}
+
+// sent 记录指令已发送，下次发送时间从本次发送时刻起算，一次性指令发送后移除
+func (s *scheduler) sent(task *pollTask, now time.Time) {
+	if task.interval > 0 {
+		task.next = now.Add(task.interval)
+		return
+	}
+	for i, t := range s.tasks {
+		if t == task {
+			s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+			break
+		}
+	}
+}
+
+// nextDue 返回最早的下次发送时间，没有指令时返回零值
+func (s *scheduler) nextDue() time.Time {
+	var next time.Time
+	for _, t := range s.tasks {
+		if next.IsZero() || t.next.Before(next) {
+			next = t.next
+		}
+	}
+	return next
+}
@@ -0,0 +1,128 @@
+package tcpserver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"tp-santak-rtu/internal/config"
+)
+
+func TestResolvePollConfig(t *testing.T) {
+	q6 := []config.PollCommandConfig{{Command: "Q6", Interval: 2 * time.Second}}
+	cfg := config.PollConfig{
+		Gap:     100 * time.Millisecond,
+		Devices: []config.DevicePollConfig{{DeviceNumber: "UPS001", Timeout: 5 * time.Second, Commands: q6}},
+	}
+
+	got := resolvePollConfig(cfg, "UPS002")
+	want := config.PollConfig{Gap: 100 * time.Millisecond, Timeout: defaultPollTimeout, Commands: defaultPollCommands}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("全局配置 = %+v, 期望 %+v", got, want)
+	}
+
+	got = resolvePollConfig(cfg, "UPS001")
+	want = config.PollConfig{Gap: 100 * time.Millisecond, Timeout: 5 * time.Second, Commands: q6}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("设备覆盖 = %+v, 期望 %+v", got, want)
+	}
+
+	if got := resolvePollConfig(config.PollConfig{}, ""); got.Gap != defaultPollGap || got.Timeout != defaultPollTimeout {
+		t.Errorf("未配置 = %+v, 期望默认间隔和超时", got)
+	}
+}
+
+func TestNewSchedulerSkipped(t *testing.T) {
+	cfg := config.PollConfig{
+		Timeout: 3 * time.Second,
+		Commands: []config.PollCommandConfig{
+			{Command: "Q6", Interval: 5 * time.Second},
+			{Command: "X9", Interval: 5 * time.Second},
+			{Command: "WA", Interval: 0},
+			{Command: "WA", Interval: 10 * time.Second, Timeout: time.Second},
+		},
+	}
+	sched, skipped := newScheduler(cfg, time.Now())
+	if !reflect.DeepEqual(skipped, []string{"X9", "WA"}) {
+		t.Errorf("skipped = %q, 期望 [X9 WA]", skipped)
+	}
+	if len(sched.tasks) != 2 || sched.tasks[0].timeout != 3*time.Second || sched.tasks[1].timeout != time.Second {
+		t.Errorf("tasks = %+v, 期望 Q6 使用默认超时、WA 使用自身超时", sched.tasks)
+	}
+}
+
+// TestSchedulerIntervals 模拟 30 秒的轮询，每次到期立即发送，统计各指令的发送时刻
+func TestSchedulerIntervals(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	sched, _ := newScheduler(config.PollConfig{
+		Gap: time.Second,
+		Commands: []config.PollCommandConfig{
+			{Command: "Q6", Interval: 5 * time.Second},
+			{Command: "WA", Interval: 10 * time.Second},
+		},
+	}, start)
+
+	sent := map[string][]time.Duration{}
+	for now := start; now.Before(start.Add(30 * time.Second)); now = now.Add(sched.gap) {
+		if task := sched.due(now); task != nil {
+			sent[task.command] = append(sent[task.command], now.Sub(start))
+			sched.sent(task, now)
+		}
+	}
+
+	// 同时到期时按配置顺序发送，WA 顺延一个间隔
+	want := map[string][]time.Duration{
+		"Q6": {0, 5 * time.Second, 10 * time.Second, 15 * time.Second, 20 * time.Second, 25 * time.Second},
+		"WA": {time.Second, 11 * time.Second, 21 * time.Second},
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("发送时刻 = %v, 期望 %v", sent, want)
+	}
+}
+
+func TestSchedulerNextDue(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	sched, _ := newScheduler(config.PollConfig{
+		Commands: []config.PollCommandConfig{
+			{Command: "Q6", Interval: 5 * time.Second},
+			{Command: "WA", Interval: 3 * time.Second},
+		},
+	}, now)
+	sched.sent(sched.due(now), now)
+	sched.sent(sched.due(now), now)
+	if task := sched.due(now.Add(time.Second)); task != nil {
+		t.Errorf("未到期时 due = %s, 期望 nil", task.command)
+	}
+	if next := sched.nextDue(); !next.Equal(now.Add(3 * time.Second)) {
+		t.Errorf("nextDue = %s, 期望 +3s", next.Sub(now))
+	}
+	if task := sched.due(now.Add(6 * time.Second)); task == nil || task.command != "WA" {
+		t.Errorf("due = %v, 期望最早到期的 WA", task)
+	}
+	if next := (&scheduler{}).nextDue(); !next.IsZero() {
+		t.Errorf("没有指令时 nextDue = %s, 期望零值", next)
+	}
+}
+
+func TestSchedulerOnce(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	sched, _ := newScheduler(config.PollConfig{
+		Timeout:  3 * time.Second,
+		Commands: []config.PollCommandConfig{{Command: "Q6", Interval: 5 * time.Second}},
+	}, now)
+	sched.sent(sched.due(now), now)
+
+	sched.once("F", now)
+	sched.once("F", now)
+	sched.once("Q6", now)
+	if len(sched.tasks) != 2 {
+		t.Fatalf("tasks = %d, 期望 2: 一次性指令不重复添加", len(sched.tasks))
+	}
+	task := sched.due(now)
+	if task == nil || task.command != "F" || task.timeout != 3*time.Second {
+		t.Fatalf("due = %+v, 期望立即发送 F", task)
+	}
+	sched.sent(task, now)
+	if len(sched.tasks) != 1 || sched.tasks[0].command != "Q6" {
+		t.Errorf("一次性指令发送后应移除: %+v", sched.tasks)
+	}
+}
@@ -0,0 +1,331 @@
+package tcpserver
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+	"tp-santak-rtu/internal/battery"
+	"tp-santak-rtu/internal/profile"
+	"tp-santak-rtu/internal/protocol"
+)
+
+// controlQueueSize 每个会话排队等待执行的控制指令数量上限
+const controlQueueSize = 8
+
+// 会话被主动关闭的原因
+const (
+	closeReplaced     = "设备重新注册，连接被新会话取代"
+	closeAdmin        = "管理接口强制断开"
+	closeShutdown     = "插件关闭"
+	closePlatform     = "平台请求断开设备"
+	closeReconfigured = "设备凭证已变更"
+)
+
+// deviceSettings 由设备配置决定的会话设置，只在会话协程中读写
+type deviceSettings struct {
+	phases  int              // 设备配置的相数，0 表示未配置
+	profile *profile.Profile // 设备选择的机型，nil 表示使用内置映射
+	sched   *scheduler
+	battery battery.Params // 机型电池参数，用于估算后备时间
+}
+
+// session 一个已注册 DTU 的轮询会话
+type session struct {
+	server    *TCPServer
+	conn      net.Conn
+	deviceID  string
+	deviceReg string // 注册包
+	voucher   string
+	control   chan *controlRequest
+	reload    chan deviceSettings // 设备配置修改后的新设置
+	closed    chan struct{}       // 会话结束时关闭
+
+	deviceSettings
+
+	closeReason atomic.Value // 主动关闭的原因，string
+	connectedAt time.Time
+	counters    sessionCounters
+}
+
+// sessionCounters 会话收发统计，由会话协程和读协程更新，管理接口读取
+type sessionCounters struct {
+	lastFrame   atomic.Int64 // 最后收到完整帧的时间，UnixNano
+	command     atomic.Value // 当前等待应答的指令，string
+	framesIn    atomic.Int64
+	framesOut   atomic.Int64
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+	decodeErrs  atomic.Int64 // 应答解析或上传失败
+	timeouts    atomic.Int64 // 应答超时
+	oversized   atomic.Int64 // 超长帧被丢弃
+	unsolicited atomic.Int64 // 未请求的应答被丢弃
+}
+
+// SessionInfo 在线会话信息
+type SessionInfo struct {
+	DeviceID       string    `json:"device_id"`
+	Voucher        string    `json:"voucher"`
+	RemoteAddr     string    `json:"remote_addr"`
+	ConnectedAt    time.Time `json:"connected_at"`
+	LastFrameAt    time.Time `json:"last_frame_at"`
+	Command        string    `json:"command"` // 当前等待应答的指令，空表示空闲
+	FramesIn       int64     `json:"frames_in"`
+	FramesOut      int64     `json:"frames_out"`
+	BytesIn        int64     `json:"bytes_in"`
+	BytesOut       int64     `json:"bytes_out"`
+	DecodeErrors   int64     `json:"decode_errors"`
+	Timeouts       int64     `json:"timeouts"`
+	OversizedDrops int64     `json:"oversized_drops"`
+	Unsolicited    int64     `json:"unsolicited"`
+}
+
+// info 返回会话当前的统计信息
+func (ss *session) info() SessionInfo {
+	c := &ss.counters
+	info := SessionInfo{
+		DeviceID:       ss.deviceID,
+		Voucher:        ss.voucher,
+		RemoteAddr:     ss.conn.RemoteAddr().String(),
+		ConnectedAt:    ss.connectedAt,
+		FramesIn:       c.framesIn.Load(),
+		FramesOut:      c.framesOut.Load(),
+		BytesIn:        c.bytesIn.Load(),
+		BytesOut:       c.bytesOut.Load(),
+		DecodeErrors:   c.decodeErrs.Load(),
+		Timeouts:       c.timeouts.Load(),
+		OversizedDrops: c.oversized.Load(),
+		Unsolicited:    c.unsolicited.Load(),
+	}
+	if ns := c.lastFrame.Load(); ns > 0 {
+		info.LastFrameAt = time.Unix(0, ns)
+	}
+	info.Command, _ = c.command.Load().(string)
+	return info
+}
+
+// pendingCommand 已发送、等待应答的指令，task 与 control 二选一
+type pendingCommand struct {
+	command  string
+	task     *pollTask
+	control  *controlRequest
+	deadline time.Time
+}
+
+// run 运行会话直到连接断开：按调度器发送轮询指令，并把应答交给对应的解析函数。
+// 同一时刻只有一条指令在等待应答，应答或超时后至少间隔 gap 再发送下一条；
+// 控制指令排在下一条轮询指令之前发送。
+func (ss *session) run() {
+	frames := make(chan string)
+	errc := make(chan error, 1)
+	defer close(ss.closed)
+	go ss.readLoop(frames, errc, ss.closed)
+
+	var pending *pendingCommand
+	var queued []*controlRequest
+	var gapUntil time.Time
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	defer func() {
+		for _, req := range queued {
+			req.result <- ErrDeviceNotConnected
+		}
+		if pending != nil && pending.control != nil {
+			pending.control.result <- ErrDeviceNotConnected
+		}
+	}()
+
+	for {
+		now := time.Now()
+		if pending == nil && !now.Before(gapUntil) {
+			if len(queued) > 0 {
+				pending = ss.sendControl(queued[0], now)
+				queued = queued[1:]
+			} else if task := ss.sched.due(now); task != nil {
+				pending = ss.send(task, now)
+			}
+		}
+		timer.Reset(ss.wakeAt(pending, gapUntil, now).Sub(now))
+
+		select {
+		case frame := <-frames:
+			if pending == nil {
+				ss.counters.unsolicited.Add(1)
+				ss.server.logger.Debugf("%s 丢弃未请求的应答: %s", ss.deviceReg, frame)
+				continue
+			}
+			ss.server.logger.Debugf("%s 客户端%s应答: %s", ss.deviceReg, pending.command, frame)
+			if pending.control != nil {
+				if !ss.controlReply(pending.control, frame) {
+					continue
+				}
+			} else if err := ss.server.upload(pending.command, frame, ss); err != nil {
+				ss.counters.decodeErrs.Add(1)
+				ss.server.logger.Errorf("%s%s上传数据失败: %v", ss.deviceReg, pending.command, err)
+			}
+			pending = ss.idle()
+			gapUntil = time.Now().Add(ss.sched.gap)
+		case req := <-ss.control:
+			queued = append(queued, req)
+		case settings := <-ss.reload:
+			// 新调度器的指令全部立即到期，等待中的应答仍按原指令处理
+			ss.deviceSettings = settings
+		case err := <-errc:
+			ss.handleReadError(err)
+			return
+		case <-timer.C:
+			if pending != nil && !time.Now().Before(pending.deadline) {
+				if pending.control != nil {
+					// 控制指令正常执行时没有应答
+					pending.control.result <- nil
+				} else {
+					ss.counters.timeouts.Add(1)
+					ss.server.logger.Warnf("%s 指令%s应答超时", ss.deviceReg, pending.command)
+				}
+				pending = ss.idle()
+				gapUntil = time.Now().Add(ss.sched.gap)
+			}
+		}
+	}
+}
+
+// send 发送轮询指令
+func (ss *session) send(task *pollTask, now time.Time) *pendingCommand {
+	ss.sched.sent(task, now)
+	if err := ss.write(task.command); err != nil {
+		ss.server.logger.Errorf("发送响应失败: %v", err)
+	}
+	return &pendingCommand{command: task.command, task: task, deadline: now.Add(task.timeout)}
+}
+
+// sendControl 发送控制指令，在应答超时时间内等待可能的 NAK
+func (ss *session) sendControl(req *controlRequest, now time.Time) *pendingCommand {
+	ss.server.logger.Infof("%s 发送控制指令: %s", ss.deviceReg, req.command)
+	if err := ss.write(req.command); err != nil {
+		req.result <- err
+		return ss.idle()
+	}
+	return &pendingCommand{command: req.command, control: req, deadline: now.Add(ss.sched.timeout)}
+}
+
+// write 向连接写入指令并记录当前等待应答的指令
+func (ss *session) write(command string) error {
+	ss.counters.command.Store(command)
+	n, err := ss.conn.Write(protocol.Encode(command))
+	ss.counters.bytesOut.Add(int64(n))
+	if err != nil {
+		return err
+	}
+	ss.counters.framesOut.Add(1)
+	return nil
+}
+
+// idle 清除当前等待应答的指令
+func (ss *session) idle() *pendingCommand {
+	ss.counters.command.Store("")
+	return nil
+}
+
+// controlReply 处理控制指令等待期间收到的帧，返回该帧是否为控制指令的应答
+func (ss *session) controlReply(req *controlRequest, frame string) bool {
+	switch frame {
+	case "(NAK":
+		req.result <- protocol.ErrNAK
+		return true
+	case "(ACK":
+		req.result <- nil
+		return true
+	default:
+		ss.server.logger.Debugf("%s 丢弃未请求的应答: %s", ss.deviceReg, frame)
+		return false
+	}
+}
+
+// wakeAt 计算下次需要处理的时间点
+func (ss *session) wakeAt(pending *pendingCommand, gapUntil, now time.Time) time.Time {
+	if pending != nil {
+		return pending.deadline
+	}
+	next := ss.sched.nextDue()
+	if next.IsZero() {
+		// 没有可用的轮询指令，只等待连接事件
+		return now.Add(time.Hour)
+	}
+	if next.Before(gapUntil) {
+		return gapUntil
+	}
+	return next
+}
+
+// readLoop 持续读取连接数据并分帧，完整的帧写入 frames，读取出错时写入 errc 后退出
+func (ss *session) readLoop(frames chan<- string, errc chan<- error, done <-chan struct{}) {
+	f := newFramer(defaultMaxFrameSize)
+	var buf [512]byte
+	for {
+		ss.conn.SetReadDeadline(time.Now().Add(ss.server.opts.HeartbeatTimeout))
+		n, err := ss.conn.Read(buf[:])
+		if err != nil {
+			errc <- err
+			return
+		}
+		ss.counters.bytesIn.Add(int64(n))
+		// 应答可能被拆成多个 TCP 分段或与下一条应答粘连，按 "\r" 重新分帧
+		messages, err := f.Feed(buf[:n])
+		if err != nil {
+			ss.counters.oversized.Add(1)
+			ss.server.logger.Warnf("%s 丢弃超长数据: %v", ss.deviceReg, err)
+		}
+		if len(messages) > 0 {
+			ss.counters.framesIn.Add(int64(len(messages)))
+			ss.counters.lastFrame.Store(time.Now().UnixNano())
+		}
+		for _, message := range messages {
+			select {
+			case frames <- message:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// close 主动关闭会话连接，会话协程随后退出
+func (ss *session) close(reason string) {
+	ss.closeReason.CompareAndSwap(nil, reason)
+	ss.conn.Close()
+}
+
+// sendStatus 上报设备在线/离线状态，已被新会话取代的会话不上报
+func (ss *session) sendStatus(status string) {
+	if !ss.server.sessions.isCurrent(ss) {
+		ss.server.logger.Debugf("%s 会话已被取代，不上报状态: %s", ss.deviceID, status)
+		return
+	}
+	ss.server.platform.SendDeviceStatus(ss.deviceID, status)
+	if status == "1" {
+		ss.server.logger.Infof("设备更新状态在线: %s", ss.deviceID)
+	} else {
+		ss.server.logger.Infof("设备更新状态离线: %s", ss.deviceID)
+	}
+}
+
+// handleReadError 处理连接读取错误
+func (ss *session) handleReadError(err error) {
+	clientAddr := ss.conn.RemoteAddr().String()
+	if reason, ok := ss.closeReason.Load().(string); ok {
+		ss.server.logger.Warnf("会话关闭: %s, %s", clientAddr, reason)
+		ss.sendStatus("0") // 被新会话取代时不会上报
+		return
+	}
+	if err == io.EOF {
+		ss.server.platform.ClearDeviceCacheByVoucher(ss.voucher)
+		ss.server.logger.Warnf("客户端主动断开连接: %s", clientAddr)
+		return
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		ss.server.logger.Warnf("读取超时: %s", clientAddr)
+		ss.sendStatus("0") // 发送设备离线状态
+		return
+	}
+	ss.server.logger.Errorf("读取客户端消息失败: %v", err)
+}
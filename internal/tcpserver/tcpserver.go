@@ -2,245 +2,473 @@
 package tcpserver
 
 import (
-	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"io"
-	"math"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"tp-santak-rtu/internal/aggregate"
+	"tp-santak-rtu/internal/alarm"
+	"tp-santak-rtu/internal/battery"
+	"tp-santak-rtu/internal/config"
+	"tp-santak-rtu/internal/energy"
 	"tp-santak-rtu/internal/platform"
+	"tp-santak-rtu/internal/profile"
+	"tp-santak-rtu/internal/protocol"
+	"tp-santak-rtu/internal/report"
 
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
 	"github.com/sirupsen/logrus"
 )
 
+// defaultHeartbeatTimeout 未配置心跳超时时使用
+const defaultHeartbeatTimeout = 60 * time.Second
+
+// Options TCP 服务器配置
+type Options struct {
+	Port             string
+	MaxConnections   int           // 最大连接数，0 表示不限制
+	HeartbeatTimeout time.Duration // 连接空闲超时，超过该时间未收到任何数据视为设备离线
+	Poll             config.PollConfig
+	Report           config.ReportConfig         // 按变化上报
+	Aggregate        config.AggregateConfig      // 遥测聚合
+	Energy           config.EnergyConfig         // 电能计量
+	Battery          config.BatteryConfig        // 电池后备时间估算
+	BatteryTest      config.BatteryTestConfig    // 定时电池自检
+	Profiles         map[string]*profile.Profile // 机型配置文件中的机型
+}
+
+// Stats TCP 服务器连接统计
+type Stats struct {
+	Connections int64 `json:"connections"` // 当前连接数，包括未注册的连接
+	Rejected    int64 `json:"rejected"`    // 超过最大连接数被拒绝的连接累计数
+}
+
 // TCPServer 代表一个 TCP 服务器
 type TCPServer struct {
 	platform *platform.PlatformClient
-	port     string
+	opts     Options
 	logger   *logrus.Logger
+
+	connections atomic.Int64
+	rejected    atomic.Int64
+
+	sessions   *registry       // 在线会话
+	discovered *discovery      // 未绑定的 DTU
+	devices    *deviceStates   // 跨会话保留的设备数据
+	alarms     *alarm.Detector // 状态位告警检测
+	report     *report.Filter  // 按变化上报
+	aggregate  *aggregate.Aggregator
+	energy     *energy.Meter          // 电能计量，nil 表示不计量
+	runtime    *battery.Estimator     // 后备时间估算
+	health     *battery.HealthTracker // 电池自检记录和健康度
+	crons      scheduleCache          // 定时自检计划
+
+	mu       sync.Mutex
+	blocked  map[string]time.Time // 平台断开后禁止重新注册的设备及截止时间
+	listener net.Listener
+	conns    map[net.Conn]struct{} // 所有连接，包括未注册的连接
+	closing  bool
+	done     chan struct{}  // Shutdown 时关闭，停止定时自检
+	wg       sync.WaitGroup // 连接处理协程
 }
 
-// NewTCPServer 创建一个新的 TCP 服务器
-func NewTCPServer(platform *platform.PlatformClient, port string, logger *logrus.Logger) *TCPServer {
-	return &TCPServer{
-		platform: platform,
-		port:     port,
-		logger:   logger,
+// NewTCPServer 创建一个新的 TCP 服务器，加载电能计量或电池校准数据失败时返回错误
+func NewTCPServer(platform *platform.PlatformClient, opts Options, logger *logrus.Logger) (*TCPServer, error) {
+	if opts.HeartbeatTimeout <= 0 {
+		opts.HeartbeatTimeout = defaultHeartbeatTimeout
+	}
+	s := &TCPServer{
+		platform:   platform,
+		opts:       opts,
+		logger:     logger,
+		sessions:   newRegistry(),
+		discovered: newDiscovery(),
+		devices:    newDeviceStates(),
+		alarms:     alarm.NewDetector(),
+		report:     report.NewFilter(opts.Report),
+		aggregate:  aggregate.New(opts.Aggregate.Window),
+		crons:      scheduleCache{parsed: make(map[string]testSchedule)},
+		conns:      make(map[net.Conn]struct{}),
+		blocked:    make(map[string]time.Time),
+		done:       make(chan struct{}),
+	}
+	if opts.Energy.File != "" {
+		meter, err := energy.Open(opts.Energy.File, opts.Energy.MaxGap)
+		if err != nil {
+			return nil, err
+		}
+		s.energy = meter
+	}
+	estimator, err := battery.NewEstimator(opts.Battery.Dir)
+	if err != nil {
+		return nil, err
 	}
+	s.runtime = estimator
+	s.health = battery.NewHealthTracker(opts.Battery.Dir)
+	return s, nil
 }
 
 // Start 启动 TCP 服务器
 func (s *TCPServer) Start() error {
-	listener, err := net.Listen("tcp", ":"+s.port)
+	listener, err := net.Listen("tcp", ":"+s.opts.Port)
 	if err != nil {
 		s.logger.WithError(err).Error("启动 TCP 服务器失败")
 		return err
 	}
 	defer listener.Close()
 
-	s.logger.Infof("TCP 服务器启动成功，监听端口: %s", s.port)
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return nil
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	s.logger.Infof("TCP 服务器启动成功，监听端口: %s", s.opts.Port)
+	go s.runAutoTests(s.done)
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				s.logger.Info("TCP 服务器停止接受连接")
+				return nil
+			}
 			s.logger.WithError(err).Error("接受 TCP 连接失败")
 			continue
 		}
-		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-		go s.handleConnection(conn)
+		if n := s.connections.Add(1); s.opts.MaxConnections > 0 && n > int64(s.opts.MaxConnections) {
+			s.connections.Add(-1)
+			rejected := s.rejected.Add(1)
+			s.logger.Warnf("连接数已达上限 %d，拒绝连接: %s (累计拒绝 %d)", s.opts.MaxConnections, conn.RemoteAddr().String(), rejected)
+			conn.Close()
+			continue
+		}
+		if !s.trackConn(conn) {
+			s.connections.Add(-1)
+			conn.Close()
+			continue
+		}
+		conn.SetReadDeadline(time.Now().Add(s.opts.HeartbeatTimeout))
+		go func() {
+			defer s.wg.Done()
+			defer s.connections.Add(-1)
+			defer s.untrackConn(conn)
+			s.handleConnection(conn)
+		}()
 	}
 }
 
-// handleConnection 处理每个客户端连接
-func (s *TCPServer) handleConnection(conn net.Conn) {
-	defer conn.Close()
-	clientAddr := conn.RemoteAddr()
-	s.logger.Infof("客户端连接: %s", clientAddr.String())
-	var accessToken string
-	var deviceReg string
-	var res string
-	reader := bufio.NewReader(conn)
-	var deviceid string
-	for {
-		var buf [512]byte
-		n, err := reader.Read(buf[:])
-		if err != nil {
-			if err == io.EOF {
-				s.platform.ClearDeviceCacheByVoucher(accessToken)
-				s.logger.Warnf("客户端主动断开连接: %s", clientAddr.String())
-			} else {
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-					s.logger.Warnf("读取超时，执行额外逻辑")
-					if deviceid != "" {
-						s.platform.SendDeviceStatus(deviceid, "0") // 发送设备离线状态
-						s.logger.Infof("设备更新状态离线: %s", deviceid)
-					} else {
-						s.logger.Warnf("设备为空，无法发送状态")
-					}
-					// 在这里执行额外的逻辑
-					// 例如：关闭连接、记录日志、发送通知等
-					conn.Close()
-					break
-				}
-				s.logger.Errorf("读取客户端消息失败: %v", err)
-			}
-			break
-		}
-		message := string(buf[:n])
-		// 打印客户端发送的消息
-		if deviceReg == "" {
-			s.logger.Infof("注册客户端消息: %s", message)
-		} else {
-			s.logger.Debugf("%s 客户端%s应答: %s", deviceReg, res, message)
-		}
-		if accessToken == "" {
-			accessToken = "{\"santak_reg_pkg\":\"" + message + "\"}"
-			deviceReg = message
-			s.logger.Infof("获取设备AccessToken: %s", accessToken)
-			device, err := s.platform.GetDeviceByVoucher(accessToken)
-			if err != nil {
-				s.logger.Infof("获取设备失败: %v", err)
-				break
-			}
-			deviceid = device.ID
-			s.logger.Infof("Device: %v", device)
-			if device.ID != "" {
-				// 处理消息
-				s.platform.SendDeviceStatus(device.ID, "1") // 发送设备在线状态
-				s.logger.Infof("设备更新状态在线: %s", deviceid)
-				res = "WA"
-				response := strings.TrimSpace(res)
-				_, err = conn.Write([]byte(response + "\r"))
-				if err != nil {
-					s.logger.Errorf("发送响应失败: %v", err)
-				}
-				conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-			} else {
-				s.logger.Warnf("验证失败，断开连接")
-				s.platform.ClearDeviceCacheByVoucher(accessToken)
-				s.logger.Warnf("客户端断开连接: %s", clientAddr.String())
-				break
-			}
-		} else {
-			if res == "WA" {
-				parts := s.splitMessage(message)
-				if len(parts) == 13 {
-					err := s.waMessageUpload(parts, deviceid)
-					if err != nil {
-						s.logger.Errorf("%sWA上传数据失败: %v", deviceReg, err)
-					}
-				} else {
-					s.logger.Debugf("%s数据WA长度不对", deviceReg)
-				}
-				res = "Q6"
-				response := strings.TrimSpace(res)
-				_, err = conn.Write([]byte(response + "\r"))
-				if err != nil {
-					s.logger.Errorf("发送响应失败: %v", err)
-				}
-				conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-			} else if res == "Q6" {
-				parts := s.splitMessage(message)
-				if len(parts) == 20 {
-					err := s.q6MessageUpload(parts, deviceid)
-					if err != nil {
-						s.logger.Errorf("%sQA上传数据失败: %v", deviceReg, err)
-					}
-				} else {
-					s.logger.Debugf("%s数据Q6长度不对", deviceReg)
-				}
-				res = "WA"
-				response := strings.TrimSpace(res)
-				_, err = conn.Write([]byte(response + "\r"))
-				if err != nil {
-					s.logger.Errorf("发送响应失败: %v", err)
-				}
-				conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-			} else {
-				s.platform.ClearDeviceCacheByVoucher(accessToken)
-				s.platform.SendDeviceStatus(deviceid, "0") // 发送设备离线状态
-				s.logger.Infof("设备更新状态离线: %s", deviceid)
-				s.logger.Errorf("未知的应答: %s", res)
-				break
-			}
+// trackConn 登记连接，服务器关闭中返回 false
+func (s *TCPServer) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
 
+func (s *TCPServer) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+// Shutdown 停止接受新连接，关闭所有会话并上报设备离线，
+// 等待连接处理协程退出，直到 ctx 结束
+func (s *TCPServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closing {
+		close(s.done)
+	}
+	s.closing = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	// 会话协程退出前上报离线状态
+	for _, ss := range s.sessions.list() {
+		ss.close(closeShutdown)
+	}
+
+	// 未注册的连接直接关闭
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if s.energy != nil {
+		if saveErr := s.energy.Save(); saveErr != nil {
+			s.logger.WithError(saveErr).Error("保存电能计量数据失败")
 		}
 	}
+	return err
 }
 
-func (s *TCPServer) splitMessage(message string) []string {
-	//将消息切分为数组
-	cleaned := strings.ReplaceAll(message, "(NAK\r", "")
-	cleaned = strings.TrimPrefix(cleaned, "(")
-	parts := strings.Fields(cleaned)
-	return parts
+// Stats 返回连接统计
+func (s *TCPServer) Stats() Stats {
+	return Stats{
+		Connections: s.connections.Load(),
+		Rejected:    s.rejected.Load(),
+	}
 }
 
-func (s *TCPServer) waMessageUpload(message []string, deviceid string) error {
-	//将WA消息解析发送到MQTT
-	data := map[string]interface{}{
-		"loadpower":            s.stringToFloadt32(message[0]),
-		"loadvirtualpower":     s.stringToFloadt32(message[3]),
-		"loadpercentage":       s.stringToFloadt32(message[11]),
-		"utilityfailstatus":    s.SliceString(message[12], 1),
-		"batterylowstatus":     s.SliceString(message[12], 2),
-		"bypassstatus":         s.SliceString(message[12], 3),
-		"upsfailedstatus":      s.SliceString(message[12], 4),
-		"upstypestatus":        s.SliceString(message[12], 5),
-		"testinprogressstatus": s.SliceString(message[12], 6),
-		"shutdownstatus":       s.SliceString(message[12], 7),
+// Sessions 返回所有在线会话的信息，按连接时间排序
+func (s *TCPServer) Sessions() []SessionInfo {
+	sessions := s.sessions.list()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, ss := range sessions {
+		infos = append(infos, ss.info())
 	}
-	s.logger.Infof("%s设备WA数据: %v", deviceid, data)
-	s.platform.SendTelemetry(deviceid, data)
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+	return infos
+}
+
+// BatteryTests 返回设备保存的电池自检记录，按时间先后排列
+func (s *TCPServer) BatteryTests(deviceID string) ([]battery.TestResult, error) {
+	return s.health.History(deviceID)
+}
+
+// CloseSession 强制断开设备的当前会话
+func (s *TCPServer) CloseSession(deviceID string) error {
+	ss := s.sessions.get(deviceID)
+	if ss == nil {
+		return ErrDeviceNotConnected
+	}
+	s.logger.Warnf("强制断开设备 %s: %s", deviceID, ss.conn.RemoteAddr().String())
+	ss.close(closeAdmin)
 	return nil
 }
 
-func (s *TCPServer) q6MessageUpload(message []string, deviceid string) error {
-	//将Q6消息解析发送到MQTT
-	data := map[string]interface{}{
-		"batterylevel":       s.stringToFloadt32(message[15]),
-		"batterytemperature": s.stringToFloadt32(message[16]),
-		"outputvoltage":      s.stringToFloadt32(message[4]),
-		"inputfrequency":     s.stringToFloadt32(message[3]),
-		"outputfrequency":    s.stringToFloadt32(message[7]),
-		"batteryvoltage":     s.stringToFloadt32(message[11]),
-		"inputvoltage":       s.stringToFloadt32(message[0]),
+// DisconnectDevice 按平台请求断开设备会话，cooldown 大于0时在该时间内拒绝设备重新注册。
+// 设备未连接时返回 ErrDeviceNotConnected，冷却期仍然生效。
+func (s *TCPServer) DisconnectDevice(deviceID string, cooldown time.Duration) error {
+	if cooldown > 0 {
+		s.mu.Lock()
+		s.blocked[deviceID] = time.Now().Add(cooldown)
+		s.mu.Unlock()
+	}
+	ss := s.sessions.get(deviceID)
+	if ss == nil {
+		return ErrDeviceNotConnected
 	}
-	s.logger.Infof("%s设备Q6数据: %v", deviceid, data)
-	s.platform.SendTelemetry(deviceid, data)
+	s.logger.Warnf("平台请求断开设备 %s: %s", deviceID, ss.conn.RemoteAddr().String())
+	s.platform.ClearDeviceCacheByVoucher(ss.voucher)
+	ss.close(closePlatform)
 	return nil
 }
 
-func (s *TCPServer) stringToFloadt32(message string) interface{} {
-	//将String消息解析Float32
-	float64Value, err := strconv.ParseFloat(message, 32)
-	var stringValue = "___._"
+// isBlocked 判断设备是否处于断开后的冷却期
+func (s *TCPServer) isBlocked(deviceID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.blocked[deviceID]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(s.blocked, deviceID)
+		return false
+	}
+	return true
+}
+
+// handleConnection 处理每个客户端连接，首包为注册包，注册成功后进入轮询会话
+func (s *TCPServer) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	clientAddr := conn.RemoteAddr()
+	s.logger.Infof("客户端连接: %s", clientAddr.String())
+
+	var buf [512]byte
+	n, err := conn.Read(buf[:])
 	if err != nil {
-		s.logger.Errorf("转换失败: %v\n", err)
-		return stringValue
-	} else {
-		roundedValue := math.Round(float64Value*10) / 10
-		return roundedValue
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			s.logger.Warnf("等待注册包超时: %s", clientAddr.String())
+		} else if err != io.EOF {
+			s.logger.Errorf("读取客户端消息失败: %v", err)
+		}
+		return
+	}
+
+	// 首包为注册包，原样作为设备凭证
+	message := string(buf[:n])
+	s.logger.Infof("注册客户端消息: %s", message)
+	accessToken := "{\"santak_reg_pkg\":\"" + message + "\"}"
+	s.logger.Infof("获取设备AccessToken: %s", accessToken)
+	device, err := s.platform.GetDeviceByVoucher(accessToken)
+	if err != nil {
+		s.logger.Infof("获取设备失败: %v", err)
+		return
+	}
+	s.logger.Infof("Device: %v", device)
+	if device.ID == "" {
+		s.logger.Warnf("验证失败，断开连接")
+		s.platform.ClearDeviceCacheByVoucher(accessToken)
+		// 记录未绑定的 DTU 及采样应答，供平台绑定新设备时选择
+		s.discovered.record(message, clientAddr.String(), s.probe(conn), time.Now())
+		s.logger.Warnf("客户端断开连接: %s", clientAddr.String())
+		return
+	}
+
+	if s.isBlocked(device.ID) {
+		s.logger.Warnf("设备 %s 处于平台断开后的冷却期，拒绝注册: %s", device.ID, clientAddr.String())
+		return
+	}
+
+	s.discovered.remove(message)
+
+	settings := s.deviceSettings(device)
+	// 每次注册(包括重连)都刷新一次额定信息
+	settings.sched.once(protocol.CmdF, time.Now())
+	settings.sched.once(protocol.CmdI, time.Now())
+	ss := &session{
+		server:    s,
+		conn:      conn,
+		deviceID:  device.ID,
+		deviceReg: message,
+		voucher:   accessToken,
+		control:   make(chan *controlRequest, controlQueueSize),
+		reload:    make(chan deviceSettings, 1),
+		closed:    make(chan struct{}),
+
+		deviceSettings: settings,
+
+		connectedAt: time.Now(),
+	}
+	// DTU 在旧连接超时前重连时，关闭旧会话，避免两个会话同时轮询同一台 UPS
+	if old := s.sessions.register(ss); old != nil {
+		s.logger.Warnf("设备 %s 重复注册，关闭旧连接: %s", device.ID, old.conn.RemoteAddr().String())
+		old.close(closeReplaced)
+	}
+	defer s.sessions.unregister(ss)
+	s.report.Forget(device.ID) // 新会话先上报一次全部最新值
+
+	ss.sendStatus("1") // 发送设备在线状态
+	ss.run()
+	s.flushTelemetry(ss)
+}
+
+// deviceSettings 按设备配置生成会话设置
+func (s *TCPServer) deviceSettings(device *types.Device) deviceSettings {
+	sched, skipped := newScheduler(resolvePollConfig(s.opts.Poll, device.DeviceNumber), time.Now())
+	if len(skipped) > 0 {
+		s.logger.Warnf("%s 忽略不支持或周期无效的轮询指令: %v", device.ID, skipped)
+	}
+	return deviceSettings{
+		phases:  configInt(device.Config, "phases"),
+		profile: s.resolveProfile(configString(device.Config, "profile")),
+		sched:   sched,
+		battery: battery.Params{
+			RuntimeFull:  configFloat(device.Config, "battery_runtime_full"),
+			RuntimeHalf:  configFloat(device.Config, "battery_runtime_half"),
+			VoltageFull:  configFloat(device.Config, "battery_voltage_full"),
+			VoltageEmpty: configFloat(device.Config, "battery_voltage_empty"),
+		},
 	}
 }
 
-func (s *TCPServer) SliceString(message string, n int) interface{} {
-	//将String消息拆分
-	// 确保 n 不超过字符串长度
-	if n > len(message) {
-		s.logger.Errorf("输入参数超出字符串长度")
+// ReloadDevice 重新获取设备配置并应用到设备的在线会话，设备未连接时返回 ErrDeviceNotConnected
+func (s *TCPServer) ReloadDevice(deviceID string) error {
+	ss := s.sessions.get(deviceID)
+	if ss == nil {
+		return ErrDeviceNotConnected
+	}
+	s.platform.ClearDeviceCacheByVoucher(ss.voucher)
+	device, err := s.platform.GetDeviceByVoucher(ss.voucher)
+	if err != nil {
+		return fmt.Errorf("获取设备配置失败: %v", err)
+	}
+	if device.ID != deviceID {
+		// 凭证已不属于该设备，断开后由 DTU 重新注册
+		s.logger.Warnf("设备 %s 凭证已变更，断开会话", deviceID)
+		ss.close(closeReconfigured)
 		return nil
 	}
-	// 截取字符串
-	subStr := message[n-1 : n]
 
-	// 转换为整数
-	num, err := strconv.Atoi(subStr)
-	if err != nil {
-		s.logger.Errorf("转换整数失败: %v", err)
+	settings := s.deviceSettings(device)
+	select {
+	case <-ss.reload: // 丢弃尚未应用的旧配置
+	default:
+	}
+	select {
+	case ss.reload <- settings:
+		s.logger.Infof("设备 %s 配置已更新: phases=%d profile=%v", deviceID, settings.phases, settings.profile != nil)
+		return nil
+	case <-ss.closed:
+		return ErrDeviceNotConnected
+	}
+}
+
+// resolveProfile 查找设备选择的机型，机型配置文件中没有该机型时返回 nil，使用内置 CKS 映射
+func (s *TCPServer) resolveProfile(name string) *profile.Profile {
+	if name == "" {
+		name = profile.DefaultName
+	}
+	if p, ok := s.opts.Profiles[name]; ok {
+		return p
+	}
+	if name != profile.DefaultName {
+		s.logger.Warnf("机型 %s 未定义，使用内置映射", name)
+	}
+	return nil
+}
+
+// configString 读取设备配置表单中的字符串项
+func configString(cfg map[string]interface{}, key string) string {
+	if v, ok := cfg[key].(string); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+// configInt 读取设备配置表单中的整数项，平台可能以字符串或数字下发，缺失或无效返回0
+func configInt(cfg map[string]interface{}, key string) int {
+	switch v := cfg[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(v))
+		return n
+	default:
 		return 0
 	}
+}
 
-	return num
+// configFloat 读取设备配置表单中的数值项，平台可能以字符串或数字下发，缺失或无效返回0
+func configFloat(cfg map[string]interface{}, key string) float64 {
+	switch v := cfg[key].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f
+	default:
+		return 0
+	}
 }
@@ -0,0 +1,192 @@
+package tcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tp-santak-rtu/internal/config"
+	"tp-santak-rtu/internal/platform"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newFakeAPI 模拟平台的设备配置接口，任意凭证都返回 deviceID 对应的设备
+func newFakeAPI(t *testing.T, deviceID string) string {
+	t.Helper()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Voucher string `json:"voucher"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":    200,
+			"message": "success",
+			"data":    map[string]interface{}{"id": deviceID, "voucher": req.Voucher},
+		})
+	}))
+	t.Cleanup(api.Close)
+	return api.URL
+}
+
+// newTestServer 创建未连接平台的 TCP 服务器
+func newTestServer(t *testing.T, opts Options) *TCPServer {
+	t.Helper()
+	s, _ := newTestServerQueue(t, opts)
+	return s
+}
+
+// newTestServerQueue 创建未连接平台的 TCP 服务器，发布失败的遥测写入临时目录中的缓存队列，返回队列文件路径
+func newTestServerQueue(t *testing.T, opts Options) (*TCPServer, string) {
+	t.Helper()
+	return newTestServerAPI(t, "http://127.0.0.1:1", opts)
+}
+
+// newTestServerAPI 同 newTestServerQueue，设备配置从 baseURL 的平台接口获取
+func newTestServerAPI(t *testing.T, baseURL string, opts Options) (*TCPServer, string) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	dir := filepath.Join(t.TempDir(), "queue")
+	p, err := platform.New(platform.Config{
+		BaseURL:  baseURL,
+		QueueDir: dir,
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	s, err := NewTCPServer(p, opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, filepath.Join(dir, "telemetry.jsonl")
+}
+
+// connectDTU 模拟 DTU 连接并发送注册包，丢弃服务器下发的指令，返回连接处理结束时关闭的 chan
+func connectDTU(t *testing.T, s *TCPServer, reg string) <-chan struct{} {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handleConnection(server)
+	}()
+	if _, err := client.Write([]byte(reg)); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(io.Discard, client)
+	return done
+}
+
+func TestDisconnectDevice(t *testing.T) {
+	s, _ := newTestServerAPI(t, newFakeAPI(t, "dev-1"), Options{})
+	done := connectDTU(t, s, "REG-1")
+	deadline := time.Now().Add(5 * time.Second)
+	for s.sessions.get("dev-1") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("设备未注册")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := s.DisconnectDevice("dev-1", time.Minute); err != nil {
+		t.Fatalf("DisconnectDevice: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("断开设备后会话未退出")
+	}
+	if s.sessions.get("dev-1") != nil {
+		t.Error("会话退出后应移除登记")
+	}
+	if err := s.DisconnectDevice("dev-1", time.Minute); !errors.Is(err, ErrDeviceNotConnected) {
+		t.Errorf("设备未连接时 err = %v, 期望 ErrDeviceNotConnected", err)
+	}
+
+	// 冷却期内重新注册被拒绝
+	select {
+	case <-connectDTU(t, s, "REG-1"):
+	case <-time.After(5 * time.Second):
+		t.Fatal("冷却期内重新注册应立即断开")
+	}
+	if s.sessions.get("dev-1") != nil {
+		t.Error("冷却期内不应登记会话")
+	}
+}
+
+func TestDisconnectDeviceCooldown(t *testing.T) {
+	s := newTestServer(t, Options{})
+	if err := s.DisconnectDevice("dev-1", 0); !errors.Is(err, ErrDeviceNotConnected) {
+		t.Errorf("err = %v, 期望 ErrDeviceNotConnected", err)
+	}
+	if s.isBlocked("dev-1") {
+		t.Error("冷却时间为 0 时不应禁止注册")
+	}
+
+	s.DisconnectDevice("dev-1", time.Minute)
+	if !s.isBlocked("dev-1") {
+		t.Error("冷却期内应禁止注册")
+	}
+	s.mu.Lock()
+	s.blocked["dev-1"] = time.Now().Add(-time.Second)
+	s.mu.Unlock()
+	if s.isBlocked("dev-1") {
+		t.Error("冷却期结束后应允许注册")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := newTestServer(t, Options{})
+	for i := 0; i < 2; i++ {
+		if err := s.Shutdown(context.Background()); err != nil {
+			t.Fatalf("第 %d 次 Shutdown: %v", i+1, err)
+		}
+	}
+	select {
+	case <-s.done:
+	default:
+		t.Error("Shutdown 后应停止定时自检")
+	}
+}
+
+func TestNewTCPServerEnergy(t *testing.T) {
+	if s := newTestServer(t, Options{}); s.energy != nil {
+		t.Error("未配置 energy.file 时不应计量")
+	}
+
+	path := filepath.Join(t.TempDir(), "energy.json")
+	if s := newTestServer(t, Options{Energy: config.EnergyConfig{File: path}}); s.energy == nil {
+		t.Fatal("配置 energy.file 后应打开计量数据")
+	}
+
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTCPServer(nil, Options{Energy: config.EnergyConfig{File: path}}, logrus.New()); err == nil {
+		t.Error("计量数据文件损坏时应返回错误")
+	}
+}
+
+func TestNewTCPServerBattery(t *testing.T) {
+	if s := newTestServer(t, Options{}); s.runtime == nil {
+		t.Error("未配置 battery.dir 时也应估算后备时间")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "calibration.json"), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTCPServer(nil, Options{Battery: config.BatteryConfig{Dir: dir}}, logrus.New()); err == nil {
+		t.Error("电池校准数据损坏时应返回错误")
+	}
+}
@@ -0,0 +1,222 @@
+package tcpserver
+
+import (
+	"sync"
+	"time"
+	"tp-santak-rtu/internal/battery"
+	"tp-santak-rtu/internal/energy"
+	"tp-santak-rtu/internal/reading"
+	"tp-santak-rtu/internal/upsstate"
+)
+
+// deviceState 设备跨会话保留的数据，DTU 重连后继续使用
+type deviceState struct {
+	mu     sync.Mutex
+	latest map[string]interface{} // 各指令最近上报的遥测值
+}
+
+// deviceStates 按设备ID索引的设备数据
+type deviceStates struct {
+	mu     sync.Mutex
+	states map[string]*deviceState
+}
+
+func newDeviceStates() *deviceStates {
+	return &deviceStates{states: make(map[string]*deviceState)}
+}
+
+// get 返回设备数据，不存在时创建
+func (d *deviceStates) get(deviceID string) *deviceState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st, ok := d.states[deviceID]
+	if !ok {
+		st = &deviceState{latest: make(map[string]interface{})}
+		d.states[deviceID] = st
+	}
+	return st
+}
+
+// merge 合并本次上报的遥测值，返回合并后全部最新值的副本
+func (st *deviceState) merge(data map[string]interface{}) map[string]interface{} {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for k, v := range data {
+		st.latest[k] = v
+	}
+	return st.copyLocked()
+}
+
+// snapshot 返回全部最新值的副本
+func (st *deviceState) snapshot() map[string]interface{} {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.copyLocked()
+}
+
+// copyLocked 复制全部最新值，调用方持有锁
+func (st *deviceState) copyLocked() map[string]interface{} {
+	readings := make(map[string]interface{}, len(st.latest))
+	for k, v := range st.latest {
+		readings[k] = v
+	}
+	return readings
+}
+
+// remove 删除不再有效的最新值
+func (st *deviceState) remove(keys ...string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, k := range keys {
+		delete(st.latest, k)
+	}
+}
+
+// deriver 由本次数据和设备最新读数计算派生遥测，返回的键值随本次数据上报
+type deriver func(s *TCPServer, ss *session, data, readings map[string]interface{}, now time.Time) map[string]interface{}
+
+// derivers 按顺序执行，后面的可以使用前面的结果
+var derivers = []deriver{
+	(*TCPServer).deriveState,
+	(*TCPServer).deriveEnergy,
+	(*TCPServer).deriveRuntime,
+	(*TCPServer).deriveBatteryHealth,
+}
+
+// publishTelemetry 所有遥测数据上传前的统一处理：合并最新读数，计算派生遥测，检测状态位变化并上报事件，
+// 数值按窗口聚合，其余键按变化上报的配置过滤
+func (s *TCPServer) publishTelemetry(ss *session, data map[string]interface{}) error {
+	now := time.Now()
+	st := s.devices.get(ss.deviceID)
+	readings := st.merge(data)
+	for _, derive := range derivers {
+		derived := derive(s, ss, data, readings, now)
+		if len(derived) == 0 {
+			continue
+		}
+		for k, v := range derived {
+			data[k] = v
+		}
+		readings = st.merge(derived)
+	}
+	for _, ev := range s.alarms.Detect(ss.deviceID, data, now) {
+		s.logger.Warnf("%s 设备事件: %s %s", ss.deviceID, ev.Method, ev.Message)
+		if err := s.platform.SendEvent(ss.deviceID, ev.Method, ev.Params(readings)); err != nil {
+			s.logger.Errorf("%s 发送事件%s失败: %v", ss.deviceID, ev.Method, err)
+		}
+	}
+	passthrough, aggregated := s.aggregate.Add(ss.deviceID, data, now)
+	// 全量上报时同样只包含不聚合的键，数值键只在窗口结束时上报
+	values := s.report.Apply(ss.deviceID, passthrough, s.aggregate.Passthrough(readings), now)
+	for k, v := range aggregated {
+		values[k] = v
+	}
+	if len(values) == 0 {
+		s.logger.Debugf("%s 遥测数据无变化，不上报", ss.deviceID)
+		return nil
+	}
+	return s.platform.SendTelemetry(ss.deviceID, values)
+}
+
+// deriveState 收到状态位时推导运行状态，Q6 等不含状态位的应答不重复上报
+func (s *TCPServer) deriveState(ss *session, data, readings map[string]interface{}, now time.Time) map[string]interface{} {
+	if _, ok := data[upsstate.KeyUtilityFail]; !ok {
+		return nil
+	}
+	state, reason := upsstate.Derive(readings)
+	return map[string]interface{}{
+		upsstate.KeyState:  string(state),
+		upsstate.KeyReason: reason,
+	}
+}
+
+// deriveEnergy 收到负载功率时累计电能
+func (s *TCPServer) deriveEnergy(ss *session, data, readings map[string]interface{}, now time.Time) map[string]interface{} {
+	power, ok := loadPower(data)
+	if !ok || s.energy == nil {
+		return nil
+	}
+	total, daily, err := s.energy.Add(ss.deviceID, power, now)
+	if err != nil {
+		s.logger.WithError(err).Error("保存电能计量数据失败")
+	}
+	return map[string]interface{}{energy.KeyTotal: total, energy.KeyDaily: daily}
+}
+
+// deriveRuntime 收到电量、电压或负载时估算后备时间
+func (s *TCPServer) deriveRuntime(ss *session, data, readings map[string]interface{}, now time.Time) map[string]interface{} {
+	if !hasAny(data, "batterylevel", "batteryvoltage", "loadpercentage") {
+		return nil
+	}
+	est, ok, err := s.runtime.Update(ss.deviceID, ss.battery, readings, now)
+	if err != nil {
+		s.logger.WithError(err).Error("保存电池校准数据失败")
+	}
+	if !ok {
+		return nil
+	}
+	// 剩余和预计后备时间只保留当前供电方式对应的一个
+	if est.OnBattery {
+		s.devices.get(ss.deviceID).remove(battery.KeyProjected)
+	} else {
+		s.devices.get(ss.deviceID).remove(battery.KeyRemaining)
+	}
+	return est.Telemetry()
+}
+
+// deriveBatteryHealth 电池自检结束时上报自检记录事件和健康度
+func (s *TCPServer) deriveBatteryHealth(ss *session, data, readings map[string]interface{}, now time.Time) map[string]interface{} {
+	result, err := s.health.Update(ss.deviceID, data, now)
+	if err != nil {
+		s.logger.WithError(err).Error("保存电池自检记录失败")
+	}
+	if result == nil {
+		return nil
+	}
+	s.logger.Infof("%s 电池自检结束: %+v", ss.deviceID, *result)
+	if err := s.platform.SendEvent(ss.deviceID, battery.EventTestCompleted, result.Params()); err != nil {
+		s.logger.Errorf("%s 发送事件%s失败: %v", ss.deviceID, battery.EventTestCompleted, err)
+	}
+	if !result.Valid {
+		return nil
+	}
+	return map[string]interface{}{battery.KeyHealth: result.Health}
+}
+
+// loadPower 返回负载总有功功率(kW)，没有总功率时按各相功率求和
+func loadPower(data map[string]interface{}) (float64, bool) {
+	if v, ok := reading.Number(data["loadpowertotal"]); ok {
+		return v, true
+	}
+	total, ok := reading.Number(data["loadpower"])
+	if !ok {
+		return 0, false
+	}
+	for _, key := range []string{"loadpower_l2", "loadpower_l3"} {
+		if v, ok := reading.Number(data[key]); ok {
+			total += v
+		}
+	}
+	return total, true
+}
+
+// hasAny 判断数据中是否包含任一键
+func hasAny(data map[string]interface{}, keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := data[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// flushTelemetry 会话结束时上报未结束的聚合窗口
+func (s *TCPServer) flushTelemetry(ss *session) {
+	aggregated := s.aggregate.Flush(ss.deviceID)
+	if len(aggregated) == 0 {
+		return
+	}
+	if err := s.platform.SendTelemetry(ss.deviceID, aggregated); err != nil {
+		s.logger.Errorf("%s 上报聚合数据失败: %v", ss.deviceID, err)
+	}
+}
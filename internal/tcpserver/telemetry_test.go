@@ -0,0 +1,132 @@
+package tcpserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+	"tp-santak-rtu/internal/battery"
+	"tp-santak-rtu/internal/config"
+	"tp-santak-rtu/internal/protocol"
+	"tp-santak-rtu/internal/upsstate"
+)
+
+// 单相机型的应答帧，WA 状态位分别为市电正常和自检中
+const (
+	frameWAOnline = "(001.8 ---.- ---.- 002.1 ---.- ---.- 001.8 002.1 009.2 ---.- ---.- 035 00000000"
+	frameWATest   = "(001.8 ---.- ---.- 002.1 ---.- ---.- 001.8 002.1 009.2 ---.- ---.- 035 00000100"
+	frameQ6Before = "(229.8 ---.- ---.- 50.0 220.1 ---.- ---.- 50.0 229.8 ---.- ---.- 081.6 ---.- 50.0 0045 100 025.0 031.0 -- --"
+	frameQ6During = "(229.8 ---.- ---.- 50.0 220.1 ---.- ---.- 50.0 229.8 ---.- ---.- 079.0 ---.- 50.0 0045 098 025.0 031.0 -- --"
+)
+
+func newTestSession(s *TCPServer, deviceID string) *session {
+	return &session{server: s, deviceID: deviceID, closed: make(chan struct{})}
+}
+
+// reply 将应答帧交给上传流程
+func reply(t *testing.T, s *TCPServer, ss *session, cmd, frame string) {
+	t.Helper()
+	if err := s.upload(cmd, frame, ss); err != nil {
+		t.Fatalf("%s 应答处理失败: %v", cmd, err)
+	}
+}
+
+// published 读取发布失败后写入缓存队列的遥测数据
+func published(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var values []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e struct {
+			Values map[string]interface{} `json:"values"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, e.Values)
+	}
+	return values
+}
+
+func TestPublishTelemetryDerived(t *testing.T) {
+	s, queue := newTestServerQueue(t, Options{Battery: config.BatteryConfig{Dir: t.TempDir()}})
+	ss := newTestSession(s, "dev-1")
+
+	reply(t, s, ss, protocol.CmdQ6, frameQ6Before)
+	reply(t, s, ss, protocol.CmdWA, frameWAOnline)
+
+	values := published(t, queue)
+	if len(values) != 2 {
+		t.Fatalf("上报 %d 条遥测, 期望 2", len(values))
+	}
+	wa := values[1]
+	if wa[upsstate.KeyState] != string(upsstate.Online) {
+		t.Errorf("%s = %v, 期望 online", upsstate.KeyState, wa[upsstate.KeyState])
+	}
+	if _, ok := wa[battery.KeyProjected]; !ok {
+		t.Errorf("收到电量和负载后应上报 %s: %v", battery.KeyProjected, wa)
+	}
+}
+
+func TestPublishTelemetryBatteryTest(t *testing.T) {
+	s, queue := newTestServerQueue(t, Options{Battery: config.BatteryConfig{Dir: t.TempDir()}})
+	ss := newTestSession(s, "dev-1")
+
+	reply(t, s, ss, protocol.CmdQ6, frameQ6Before)
+	reply(t, s, ss, protocol.CmdWA, frameWATest)
+	reply(t, s, ss, protocol.CmdQ6, frameQ6During)
+	reply(t, s, ss, protocol.CmdWA, frameWAOnline)
+
+	results, err := s.BatteryTests("dev-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("自检记录 %d 条, 期望 1", len(results))
+	}
+	r := results[0]
+	if !r.Valid || r.VoltageBefore != 81.6 || r.VoltageMin != 79 {
+		t.Errorf("自检记录 = %+v", r)
+	}
+	// 跌落 3.19%，超出 2% 的部分每 1% 扣 8 分
+	values := published(t, queue)
+	if health := values[len(values)-1][battery.KeyHealth]; health != 90.0 {
+		t.Errorf("%s = %v, 期望 90", battery.KeyHealth, health)
+	}
+}
+
+func TestPublishTelemetryAggregated(t *testing.T) {
+	s, queue := newTestServerQueue(t, Options{
+		Report:    config.ReportConfig{Enabled: true, SnapshotInterval: time.Hour},
+		Aggregate: config.AggregateConfig{Window: time.Hour},
+	})
+	ss := newTestSession(s, "dev-1")
+
+	reply(t, s, ss, protocol.CmdWA, frameWAOnline)
+
+	values := published(t, queue)
+	if len(values) != 1 {
+		t.Fatalf("上报 %d 条遥测, 期望 1", len(values))
+	}
+	// 首次全量上报不包含窗口内的数值
+	for _, key := range []string{"loadpercentage", "loadpower", battery.KeyProjected} {
+		if _, ok := values[0][key]; ok {
+			t.Errorf("聚合窗口内不应上报数值键 %s: %v", key, values[0])
+		}
+	}
+	if _, ok := values[0][upsstate.KeyUtilityFail]; !ok {
+		t.Errorf("状态位应立即上报: %v", values[0])
+	}
+
+	s.flushTelemetry(ss)
+	values = published(t, queue)
+	if v := values[len(values)-1]["loadpercentage_avg"]; v != 35.0 {
+		t.Errorf("窗口结束时 loadpercentage_avg = %v, 期望 35", v)
+	}
+}
@@ -0,0 +1,207 @@
+package tcpserver
+
+import (
+	"fmt"
+	"tp-santak-rtu/internal/profile"
+	"tp-santak-rtu/internal/protocol"
+	"tp-santak-rtu/internal/reading"
+)
+
+// pollUploaders 轮询指令对应的应答解析上传函数
+var pollUploaders = map[string]func(s *TCPServer, message string, ss *session) error{
+	protocol.CmdWA: (*TCPServer).waMessageUpload,
+	protocol.CmdQ6: (*TCPServer).q6MessageUpload,
+	protocol.CmdQ1: (*TCPServer).q1MessageUpload,
+	protocol.CmdF:  (*TCPServer).ratingAttributesUpload,
+	protocol.CmdI:  (*TCPServer).infoAttributesUpload,
+}
+
+// isPollCommand 判断指令是否支持轮询
+func isPollCommand(cmd string) bool {
+	_, ok := pollUploaders[cmd]
+	return ok
+}
+
+// upload 按指令解析应答并上传，设备机型定义了该指令时按机型映射解析
+func (s *TCPServer) upload(cmd string, message string, ss *session) error {
+	if ss.profile != nil && cmd != protocol.CmdF && cmd != protocol.CmdI {
+		if c := ss.profile.Command(cmd); c != nil {
+			return s.profileMessageUpload(c, message, ss)
+		}
+	}
+	uploader, ok := pollUploaders[cmd]
+	if !ok {
+		return fmt.Errorf("未知的应答: %s", cmd)
+	}
+	return uploader(s, message, ss)
+}
+
+// profileMessageUpload 按机型映射解析应答并发送到MQTT
+func (s *TCPServer) profileMessageUpload(c *profile.CommandProfile, message string, ss *session) error {
+	data, err := c.Decode(message, ss.phases)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("%s设备%s数据(%s): %v", ss.deviceID, c.Command, ss.profile.Name, data)
+	return s.publishTelemetry(ss, data)
+}
+
+// waMessageUpload 解析WA应答并发送到MQTT
+func (s *TCPServer) waMessageUpload(message string, ss *session) error {
+	data, err := waTelemetry(message, ss.phases)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("%s设备WA数据: %v", ss.deviceID, data)
+	return s.publishTelemetry(ss, data)
+}
+
+// waTelemetry 将WA应答转换为遥测数据
+func waTelemetry(message string, phases int) (map[string]interface{}, error) {
+	r, err := protocol.ParseWA(message)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{}
+	phaseTelemetry(data, phases, "loadpower", r.LoadPower)
+	phaseTelemetry(data, phases, "loadvirtualpower", r.LoadApparentPower)
+	valueTelemetry(data, "loadpowertotal", r.LoadPowerTotal)
+	valueTelemetry(data, "loadvirtualpowertotal", r.LoadApparentPowerTotal)
+	phaseTelemetry(data, phases, "outputcurrent", r.OutputCurrent)
+	valueTelemetry(data, "loadpercentage", r.LoadPercentage)
+	statusTelemetry(data, r.Status)
+	return data, nil
+}
+
+// q6MessageUpload 解析Q6应答并发送到MQTT
+func (s *TCPServer) q6MessageUpload(message string, ss *session) error {
+	data, err := q6Telemetry(message, ss.phases)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("%s设备Q6数据: %v", ss.deviceID, data)
+	return s.publishTelemetry(ss, data)
+}
+
+// q6Telemetry 将Q6应答转换为遥测数据
+func q6Telemetry(message string, phases int) (map[string]interface{}, error) {
+	r, err := protocol.ParseQ6(message)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{}
+	phaseTelemetry(data, phases, "inputvoltage", r.InputVoltage)
+	valueTelemetry(data, "inputfrequency", r.InputFrequency)
+	phaseTelemetry(data, phases, "outputvoltage", r.OutputVoltage)
+	valueTelemetry(data, "outputfrequency", r.OutputFrequency)
+	phaseTelemetry(data, phases, "bypassvoltage", r.BypassVoltage)
+	valueTelemetry(data, "batteryvoltage", r.BatteryVoltage)
+	if phases != phasesSingle {
+		valueTelemetry(data, "batteryvoltagenegative", r.BatteryVoltageNegative)
+	}
+	valueTelemetry(data, "bypassfrequency", r.BypassFrequency)
+	valueTelemetry(data, "batteryremaintime", r.BatteryRemainTime)
+	valueTelemetry(data, "batterylevel", r.BatteryLevel)
+	valueTelemetry(data, "batterytemperature", r.BatteryTemperature)
+	valueTelemetry(data, "upstemperature", r.Temperature)
+	if r.FaultCode != "" {
+		data["faultcode"] = r.FaultCode
+	}
+	if r.WarningCode != "" {
+		data["warningcode"] = r.WarningCode
+	}
+	return data, nil
+}
+
+// q1MessageUpload 解析Q1应答并发送到MQTT
+func (s *TCPServer) q1MessageUpload(message string, ss *session) error {
+	data, err := q1Telemetry(message)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("%s设备Q1数据: %v", ss.deviceID, data)
+	return s.publishTelemetry(ss, data)
+}
+
+// q1Telemetry 将Q1应答转换为遥测数据
+func q1Telemetry(message string) (map[string]interface{}, error) {
+	r, err := protocol.ParseQ1(message)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{
+		"inputvoltage":      r.InputVoltage,
+		"inputfaultvoltage": r.InputFaultVoltage,
+		"outputvoltage":     r.OutputVoltage,
+		"loadpercentage":    r.LoadPercentage,
+		"inputfrequency":    r.InputFrequency,
+		"batteryvoltage":    r.BatteryVoltage,
+		"upstemperature":    r.Temperature,
+		"beeperstatus":      reading.BoolToInt(r.BeeperOn),
+	}
+	statusTelemetry(data, r.Status)
+	return data, nil
+}
+
+// ratingAttributesUpload 解析F应答并作为设备属性发送
+func (s *TCPServer) ratingAttributesUpload(message string, ss *session) error {
+	r, err := protocol.ParseRating(message)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"ratedvoltage":        r.Voltage,
+		"ratedcurrent":        r.Current,
+		"ratedbatteryvoltage": r.BatteryVoltage,
+		"ratedfrequency":      r.Frequency,
+	}
+	s.logger.Infof("%s设备额定信息: %v", ss.deviceID, data)
+	return s.platform.SendAttributes(ss.deviceID, data)
+}
+
+// infoAttributesUpload 解析I应答并作为设备属性发送
+func (s *TCPServer) infoAttributesUpload(message string, ss *session) error {
+	r, err := protocol.ParseUPSInfo(message)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"company":         r.Company,
+		"model":           r.Model,
+		"firmwareversion": r.Version,
+	}
+	s.logger.Infof("%s设备型号信息: %v", ss.deviceID, data)
+	return s.platform.SendAttributes(ss.deviceID, data)
+}
+
+// valueTelemetry 写入数值字段，占位符字段不上报
+func valueTelemetry(data map[string]interface{}, key string, v protocol.Value) {
+	if v.Valid {
+		data[key] = v.Float
+	}
+}
+
+// phasesSingle 设备配置表单中的单相设置，三相为3，未配置时按应答中的有效字段上报
+const phasesSingle = 1
+
+// phaseTelemetry 写入分相字段，L1 沿用不带后缀的键名，L2/L3 追加 "_l2"、"_l3"。
+// 单相设备只上报 L1。
+func phaseTelemetry(data map[string]interface{}, phases int, key string, values [3]protocol.Value) {
+	valueTelemetry(data, key, values[0])
+	if phases == phasesSingle {
+		return
+	}
+	valueTelemetry(data, key+"_l2", values[1])
+	valueTelemetry(data, key+"_l3", values[2])
+}
+
+// statusTelemetry 将状态位写入遥测数据，取值 0/1
+func statusTelemetry(data map[string]interface{}, st protocol.StatusBits) {
+	data["utilityfailstatus"] = reading.BoolToInt(st.UtilityFail)
+	data["batterylowstatus"] = reading.BoolToInt(st.BatteryLow)
+	data["bypassstatus"] = reading.BoolToInt(st.Bypass)
+	data["upsfailedstatus"] = reading.BoolToInt(st.UPSFailed)
+	data["upstypestatus"] = reading.BoolToInt(st.Standby)
+	data["testinprogressstatus"] = reading.BoolToInt(st.TestInProgress)
+	data["shutdownstatus"] = reading.BoolToInt(st.ShutdownActive)
+}
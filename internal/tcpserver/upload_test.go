@@ -0,0 +1,53 @@
+package tcpserver
+
+import (
+	"reflect"
+	"testing"
+	"tp-santak-rtu/internal/profile"
+	"tp-santak-rtu/internal/protocol"
+)
+
+// TestCKSProfileMatchesBuiltin 配置文件中的 cks 映射与内置解析对同一应答上报完全相同的数据
+func TestCKSProfileMatchesBuiltin(t *testing.T) {
+	profiles, err := profile.Load("../../configs/profiles.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cks := profiles[profile.DefaultName]
+	if cks == nil {
+		t.Fatal("profiles.yaml 缺少 cks 机型")
+	}
+
+	builtin := map[string]func(message string, phases int) (map[string]interface{}, error){
+		protocol.CmdWA: waTelemetry,
+		protocol.CmdQ6: q6Telemetry,
+		protocol.CmdQ1: func(message string, _ int) (map[string]interface{}, error) { return q1Telemetry(message) },
+	}
+	tests := []struct {
+		cmd   string
+		frame string
+	}{
+		{protocol.CmdWA, "(001.8 ---.- ---.- 002.1 ---.- ---.- 001.8 002.1 009.2 ---.- ---.- 035 10000000"},
+		{protocol.CmdWA, "(003.1 002.9 003.4 003.6 003.3 003.9 009.4 010.8 014.2 013.6 015.1 042 00000100"},
+		{protocol.CmdWA, "(001.84 ---.- ---.- 002.15 ---.- ---.- 1.849 002.1 009.26 ---.- ---.- 035 0000000"},
+		{protocol.CmdQ6, "(229.8 ---.- ---.- 50.0 220.1 ---.- ---.- 50.0 229.8 ---.- ---.- 081.6 ---.- 50.0 0045 100 025.0 031.0 -- --"},
+		{protocol.CmdQ6, "(229.8 230.4 228.9 50.0 220.1 220.0 219.8 50.0 229.8 230.4 228.9 272.4 272.1 50.0 0120 095 026.5 033.0 00 02"},
+		{protocol.CmdQ1, "(208.4 140.0 208.4 034 59.9 2.05 35.0 00110001"},
+		{protocol.CmdQ1, "(230.15 140.0 229.96 100 49.95 13.576 41.25 10000000"},
+	}
+	for _, tt := range tests {
+		for _, phases := range []int{0, 1, 3} {
+			want, err := builtin[tt.cmd](tt.frame, phases)
+			if err != nil {
+				t.Fatalf("内置解析 %s: %v", tt.frame, err)
+			}
+			got, err := cks.Command(tt.cmd).Decode(tt.frame, phases)
+			if err != nil {
+				t.Fatalf("cks 映射 %s: %v", tt.frame, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s phases=%d\ncks 映射 %v\n内置解析 %v", tt.frame, phases, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package upsstate 由 WA/Q1 状态位推导 UPS 运行状态。
+package upsstate
+
+import (
+	"strings"
+	"tp-santak-rtu/internal/reading"
+)
+
+// State UPS 运行状态
+type State string
+
+const (
+	Online          State = "online"           // 市电供电
+	OnBattery       State = "on-battery"       // 市电中断，电池供电
+	OnBypass        State = "on-bypass"        // 旁路供电
+	BatteryTest     State = "battery-test"     // 电池自检中
+	Fault           State = "fault"            // UPS 故障
+	ShutdownPending State = "shutdown-pending" // 关机倒计时中
+	Unknown         State = "unknown"          // 尚未收到状态位
+)
+
+// 推导使用的状态位遥测键
+const (
+	KeyUtilityFail    = "utilityfailstatus"
+	KeyBatteryLow     = "batterylowstatus"
+	KeyBypass         = "bypassstatus"
+	KeyUPSFailed      = "upsfailedstatus"
+	KeyTestInProgress = "testinprogressstatus"
+	KeyShutdown       = "shutdownstatus"
+)
+
+// 发布的遥测键
+const (
+	KeyState  = "upsstate"
+	KeyReason = "upsstatereason"
+)
+
+// Derive 由设备最新读数推导运行状态和说明。多个状态位同时置位时按
+// 故障、关机倒计时、电池自检、电池供电、旁路的顺序取第一个，其余作为说明附加。
+func Derive(readings map[string]interface{}) (State, string) {
+	utilityFail, ok1 := reading.Flag(readings, KeyUtilityFail)
+	bypass, ok2 := reading.Flag(readings, KeyBypass)
+	failed, ok3 := reading.Flag(readings, KeyUPSFailed)
+	if !ok1 && !ok2 && !ok3 {
+		return Unknown, "未收到状态位"
+	}
+	test, _ := reading.Flag(readings, KeyTestInProgress)
+	shutdown, _ := reading.Flag(readings, KeyShutdown)
+	batteryLow, _ := reading.Flag(readings, KeyBatteryLow)
+
+	var reasons []string
+	state := Online
+	set := func(s State, active bool, reason string) {
+		if !active {
+			return
+		}
+		if state == Online {
+			state = s
+		}
+		reasons = append(reasons, reason)
+	}
+	set(Fault, failed, "UPS故障")
+	set(ShutdownPending, shutdown, "关机倒计时中")
+	set(BatteryTest, test, "电池自检中")
+	set(OnBattery, utilityFail, "市电中断，电池供电")
+	set(OnBypass, bypass, "旁路供电")
+	if batteryLow {
+		reasons = append(reasons, "电池电压低")
+	}
+	if len(reasons) == 0 {
+		return Online, "市电供电"
+	}
+	return state, strings.Join(reasons, "，")
+}
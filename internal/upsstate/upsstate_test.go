@@ -0,0 +1,116 @@
+package upsstate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// bits 按推导优先级排列的状态位，batteryLow 不影响状态，只附加说明
+var bits = []struct {
+	key    string
+	state  State
+	reason string
+}{
+	{KeyUPSFailed, Fault, "UPS故障"},
+	{KeyShutdown, ShutdownPending, "关机倒计时中"},
+	{KeyTestInProgress, BatteryTest, "电池自检中"},
+	{KeyUtilityFail, OnBattery, "市电中断，电池供电"},
+	{KeyBypass, OnBypass, "旁路供电"},
+	{KeyBatteryLow, "", "电池电压低"},
+}
+
+// TestDeriveTruthTable 遍历 6 个状态位的全部 64 种组合
+func TestDeriveTruthTable(t *testing.T) {
+	for mask := 0; mask < 1<<len(bits); mask++ {
+		readings := make(map[string]interface{}, len(bits))
+		wantState := Online
+		var reasons []string
+		for i, b := range bits {
+			active := mask&(1<<i) != 0
+			readings[b.key] = 0
+			if !active {
+				continue
+			}
+			readings[b.key] = 1
+			if wantState == Online && b.state != "" {
+				wantState = b.state
+			}
+			reasons = append(reasons, b.reason)
+		}
+		wantReason := strings.Join(reasons, "，")
+		if wantReason == "" {
+			wantReason = "市电供电"
+		}
+
+		t.Run(fmt.Sprintf("%06b", mask), func(t *testing.T) {
+			state, reason := Derive(readings)
+			if state != wantState || reason != wantReason {
+				t.Errorf("Derive(%v) = %s %q, 期望 %s %q", readings, state, reason, wantState, wantReason)
+			}
+		})
+	}
+}
+
+func TestDeriveExamples(t *testing.T) {
+	tests := []struct {
+		name       string
+		readings   map[string]interface{}
+		wantState  State
+		wantReason string
+	}{
+		{
+			name:       "市电供电",
+			readings:   map[string]interface{}{KeyUtilityFail: 0, KeyBypass: 0, KeyUPSFailed: 0},
+			wantState:  Online,
+			wantReason: "市电供电",
+		},
+		{
+			name:       "电池供电且电压低",
+			readings:   map[string]interface{}{KeyUtilityFail: 1, KeyBatteryLow: 1, KeyBypass: 0, KeyUPSFailed: 0},
+			wantState:  OnBattery,
+			wantReason: "市电中断，电池供电，电池电压低",
+		},
+		{
+			name:       "故障优先于旁路",
+			readings:   map[string]interface{}{KeyUtilityFail: 0, KeyBypass: 1, KeyUPSFailed: 1},
+			wantState:  Fault,
+			wantReason: "UPS故障，旁路供电",
+		},
+		{
+			name:       "浮点状态值",
+			readings:   map[string]interface{}{KeyUtilityFail: 0.0, KeyBypass: 1.0, KeyUPSFailed: 0.0},
+			wantState:  OnBypass,
+			wantReason: "旁路供电",
+		},
+		{
+			name:       "只有部分状态位",
+			readings:   map[string]interface{}{KeyBypass: 1},
+			wantState:  OnBypass,
+			wantReason: "旁路供电",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, reason := Derive(tt.readings)
+			if state != tt.wantState || reason != tt.wantReason {
+				t.Errorf("Derive = %s %q, 期望 %s %q", state, reason, tt.wantState, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestDeriveUnknown(t *testing.T) {
+	for name, readings := range map[string]map[string]interface{}{
+		"空读数":      {},
+		"只有 Q6 读数": {"batterylevel": 100.0, "inputvoltage": 229.8},
+		"缺少主要状态位":  {KeyTestInProgress: 1, KeyShutdown: 1, KeyBatteryLow: 1},
+		"状态值类型错误":  {KeyUtilityFail: "1", KeyBypass: "0", KeyUPSFailed: nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if state, reason := Derive(readings); state != Unknown || reason != "未收到状态位" {
+				t.Errorf("Derive(%v) = %s %q, 期望 unknown", readings, state, reason)
+			}
+		})
+	}
+}